@@ -4,10 +4,32 @@
 //
 // Usage:
 //
-//	module-builder <command> [arguments]
+//	module-builder [-config file] [-format text|json] <command> [arguments]
 //
 // The commands are:
 //
 //	module	build archive(s) for module(s) and update the index.yaml
 //	sort	sorts index-dev.yaml and index.yaml
+//	yank	withdraw a released module version
+//	prune	remove old module versions from the index.yaml and output directory
+//	index-diff	compare indexes between files or git revisions
+//	index-merge	merge several indexes into a single one
+//	resolve	find the newest module version satisfying a semver constraint
+//	bundle	pack a channel index with its archives into an offline bundle
+//	unbundle	verify and extract an offline bundle
+//	keygen	generate an ed25519 key pair for signing
+//	verify-signature	verify detached signatures of archives and indexes
+//	verify-provenance	check provenance attestations of archives
+//	sbom	emit software bills of materials of module archives
+//	serve	serve the output directory like the public binary repository
+//	mirror	download a remote index and its archives into a local directory
+//	publish	upload archives, sidecars and indexes to an Artifactory-compatible repository
+//	oci-push	push modules and the index to an OCI registry
+//	oci-pull	pull modules and the index from an OCI registry
+//	manifests	render indexes as Kubernetes manifests
+//	apply	apply a channel index to a cluster with the server-side apply
+//	new	scaffold a new module
+//	release	build modules, sidecars and indexes into the artifacts directory
+//	check	rebuild modules in a temporary worktree and compare with committed files
+//	status	show versions and unreleased changes of modules
 package main
@@ -0,0 +1,196 @@
+package apply
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/indexdiff"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FieldManager is the default field manager of applied objects.
+	FieldManager = "module-builder"
+
+	// ProtectedName is the object synchronized from an external
+	// source, it is never applied unless forced.
+	ProtectedName = "mcc-modules"
+)
+
+// ErrProtected is returned on an attempt to apply the protected object.
+var ErrProtected = errors.New("object is managed externally")
+
+// Resource is the HostOSConfigurationModules resource name.
+const Resource = "hostosconfigurationmodules"
+
+type Config struct {
+	LogWriter      io.Writer         // logger
+	DiffWriter     io.Writer         // where to show differences with the live object
+	Client         dynamic.Interface // cluster client
+	Channel        config.Channel    // channel with the object to apply
+	FieldManager   string            // field manager, FieldManager if empty
+	DryRun         bool              // only validate the request on the server
+	Force          bool              // allow to apply the protected object
+	ForceConflicts bool              // take ownership of fields managed by others
+}
+
+// Object shows differences between the channel index and the live object,
+// then applies the index with the server-side apply if there are any.
+// It reports whether the object is changed.
+func Object(ctx context.Context, cfg Config) (bool, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	idx, err := index.Read(ctx, cfg.Channel.File)
+	if err != nil {
+		return false, err
+	}
+	name := idx.Metadata.Name
+	if name == ProtectedName && !cfg.Force {
+		return false, fmt.Errorf("refusing to apply %s: %w, force to override", name, ErrProtected)
+	}
+
+	gvr, err := GVR(cfg.Channel.APIVersion)
+	if err != nil {
+		return false, fmt.Errorf("channel %s: %w", cfg.Channel.Name, err)
+	}
+
+	desired, err := toUnstructured(ctx, idx)
+	if err != nil {
+		return false, err
+	}
+	desired.SetAPIVersion(gvr.GroupVersion().String())
+
+	resource := cfg.Client.Resource(gvr)
+	live, err := resource.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		live = nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get %s: %w", name, err)
+	}
+
+	if live != nil && reflect.DeepEqual(live.Object["spec"], desired.Object["spec"]) {
+		l.Printf("Object %s is up to date", name)
+		return false, nil
+	}
+
+	if err := writeDiff(cfg.DiffWriter, cfg.Channel.Name, live, desired, idx.Spec.Modules); err != nil {
+		return false, err
+	}
+
+	opts := metav1.ApplyOptions{
+		FieldManager: cfg.FieldManager,
+		Force:        cfg.ForceConflicts,
+	}
+	if opts.FieldManager == "" {
+		opts.FieldManager = FieldManager
+	}
+	if cfg.DryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	if _, err := resource.Apply(ctx, name, desired, opts); err != nil {
+		return false, fmt.Errorf("failed to apply %s: %w", name, err)
+	}
+
+	if cfg.DryRun {
+		l.Printf("Object %s is applied with the server dry-run", name)
+	} else {
+		l.Printf("Object %s is applied by the %s field manager", name, opts.FieldManager)
+	}
+
+	return true, nil
+}
+
+// GVR returns the HostOSConfigurationModules resource of the API version,
+// domain.HOCMAPIVersion if empty.
+func GVR(apiVersion string) (schema.GroupVersionResource, error) {
+	if apiVersion == "" {
+		apiVersion = domain.HOCMAPIVersion
+	}
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid apiVersion %q: %w", apiVersion, err)
+	}
+	if gv.Group == "" || gv.Version == "" {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid apiVersion %q: expected <group>/<version>", apiVersion)
+	}
+
+	return gv.WithResource(Resource), nil
+}
+
+// toUnstructured converts the index to the object to apply.
+func toUnstructured(ctx context.Context, idx domain.HostOSConfigurationModules) (*unstructured.Unstructured, error) {
+	var buf bytes.Buffer
+	if err := index.Encode(ctx, &buf, idx); err != nil {
+		return nil, fmt.Errorf("failed to serialize %s: %w", idx.Metadata.Name, err)
+	}
+
+	data, err := yaml.YAMLToJSON(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", idx.Metadata.Name, err)
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", idx.Metadata.Name, err)
+	}
+
+	return obj, nil
+}
+
+// writeDiff shows modules added, removed or re-hashed in the live object.
+func writeDiff(w io.Writer, channel string, live, desired *unstructured.Unstructured, modules []domain.Module) error {
+	if live == nil {
+		fmt.Fprintf(w, "%s %s is created\n", desired.GetKind(), desired.GetName())
+	} else {
+		fmt.Fprintf(w, "%s %s is updated\n", desired.GetKind(), desired.GetName())
+	}
+
+	report := indexdiff.Modules(channel, liveModules(live), modules)
+	if report.IsEmpty() {
+		_, err := fmt.Fprintln(w, "Module details are changed.")
+		return err
+	}
+
+	return report.WriteText(w)
+}
+
+// liveModules returns name, version and sha256sum of modules of the live object.
+func liveModules(live *unstructured.Unstructured) []domain.Module {
+	if live == nil {
+		return nil
+	}
+
+	items, _, _ := unstructured.NestedSlice(live.Object, "spec", "modules")
+	modules := make([]domain.Module, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		var m domain.Module
+		m.Name, _, _ = unstructured.NestedString(fields, "name")
+		m.Version, _, _ = unstructured.NestedString(fields, "version")
+		m.Sha256Sum, _, _ = unstructured.NestedString(fields, "sha256sum")
+		modules = append(modules, m)
+	}
+
+	return modules
+}
@@ -0,0 +1,175 @@
+package apply
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// v1beta1 is a HostOSConfigurationModules resource version other than the default one.
+var v1beta1 = schema.GroupVersionResource{Group: "kaas.mirantis.com", Version: "v1beta1", Resource: Resource}
+
+// newClient returns the fake client storing applied objects as is,
+// the fake object tracker does not support server-side apply.
+func newClient(t *testing.T) *dynamicfake.FakeDynamicClient {
+	t.Helper()
+
+	gvr, err := GVR(domain.HOCMAPIVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "HostOSConfigurationModulesList", v1beta1: "HostOSConfigurationModulesList"})
+
+	client.PrependReactor("patch", Resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+
+		tracker := client.Tracker()
+		if _, err := tracker.Get(patch.GetResource(), "", patch.GetName()); apierrors.IsNotFound(err) {
+			return true, obj, tracker.Create(patch.GetResource(), obj, "")
+		}
+		return true, obj, tracker.Update(patch.GetResource(), obj, "")
+	})
+
+	return client
+}
+
+func writeIndex(t *testing.T, name, version string) config.Channel {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "index.yaml")
+	data := `apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfigurationModules
+metadata:
+  name: ` + name + `
+spec:
+  modules:
+    - name: ntp
+      version: ` + version + `
+      sha256sum: 0a27289c3cff8634141c065451d0dd91bdd7a289d4b378c3cc1416fe4e78def0
+      size: 2614
+`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return config.Channel{Name: "dev", File: file, ObjectName: name, Stage: config.StageDev}
+}
+
+func patches(client *dynamicfake.FakeDynamicClient) int {
+	n := 0
+	for _, a := range client.Actions() {
+		if a.GetVerb() == "patch" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestObject(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	var diff strings.Builder
+	cfg := Config{LogWriter: io.Discard, DiffWriter: &diff, Client: client, Channel: writeIndex(t, "dev-mcc-modules", "1.1.0-dev")}
+
+	changed, err := Object(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !strings.Contains(diff.String(), "is created") || !strings.Contains(diff.String(), "added ntp-1.1.0-dev") {
+		t.Fatalf("unexpected diff %q", diff.String())
+	}
+
+	gvr, err := GVR("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := client.Resource(gvr).Get(ctx, "dev-mcc-modules", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modules := liveModules(live); len(modules) != 1 || modules[0].Version != "1.1.0-dev" {
+		t.Fatalf("unexpected live modules %+v", modules)
+	}
+
+	// applying the same index is a no-op
+	changed, err = Object(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || patches(client) != 1 {
+		t.Fatalf("expected no changes, got %d patches", patches(client))
+	}
+
+	diff.Reset()
+	cfg.Channel = writeIndex(t, "dev-mcc-modules", "1.1.1-dev")
+	if _, err := Object(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.String(), "removed ntp-1.1.0-dev") || !strings.Contains(diff.String(), "added ntp-1.1.1-dev") {
+		t.Fatalf("unexpected diff %q", diff.String())
+	}
+}
+
+func TestObjectProtected(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	cfg := Config{LogWriter: io.Discard, DiffWriter: io.Discard, Client: client, Channel: writeIndex(t, ProtectedName, "1.1.0")}
+	if _, err := Object(ctx, cfg); !errors.Is(err, ErrProtected) {
+		t.Fatalf("expected protected error, got %v", err)
+	}
+	if len(client.Actions()) != 0 {
+		t.Fatalf("unexpected actions %v", client.Actions())
+	}
+
+	cfg.Force = true
+	if changed, err := Object(ctx, cfg); err != nil || !changed {
+		t.Fatalf("expected forced apply, got %t, %v", changed, err)
+	}
+}
+
+func TestObjectAPIVersion(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	cfg := Config{LogWriter: io.Discard, DiffWriter: io.Discard, Client: client, Channel: writeIndex(t, "dev-mcc-modules", "1.1.0-dev")}
+	cfg.Channel.APIVersion = v1beta1.GroupVersion().String()
+	if _, err := Object(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := client.Resource(v1beta1).Get(ctx, "dev-mcc-modules", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live.GetAPIVersion() != cfg.Channel.APIVersion {
+		t.Errorf("expected apiVersion %s, got %s", cfg.Channel.APIVersion, live.GetAPIVersion())
+	}
+
+	for _, apiVersion := range []string{"v1", "kaas.mirantis.com/", "kaas.mirantis.com/v1/v2"} {
+		cfg.Channel.APIVersion = apiVersion
+		if _, err := Object(ctx, cfg); err == nil || !strings.Contains(err.Error(), "invalid apiVersion") {
+			t.Errorf("%s: expected invalid apiVersion error, got %v", apiVersion, err)
+		}
+	}
+}
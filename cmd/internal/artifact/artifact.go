@@ -0,0 +1,111 @@
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/archive"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SidecarSuffix is appended to an artifact file name to get its sidecar.
+	SidecarSuffix = ".metadata.yaml"
+
+	// RepoPath is the path of artifacts in the public binary repository.
+	RepoPath = "bm/bin/host-os-modules"
+
+	keyPrefix = "binary:bm:host-os-modules:"
+)
+
+// Sidecar represents the .metadata.yaml file published next to an artifact.
+type Sidecar struct {
+	Key       string `yaml:"key"`
+	Version   string `yaml:"version,omitempty"`
+	Sha256Sum string `yaml:"sha256sum,omitempty"`
+}
+
+// ModuleSidecar returns the sidecar of the module archive.
+func ModuleSidecar(m domain.Module) Sidecar {
+	return Sidecar{
+		Key:       keyPrefix + m.Name,
+		Version:   m.Version,
+		Sha256Sum: m.Sha256Sum,
+	}
+}
+
+// IndexSidecar returns the sidecar of the index file.
+func IndexSidecar(indexFile string) Sidecar {
+	return Sidecar{
+		Key: keyPrefix + strings.TrimSuffix(filepath.Base(indexFile), filepath.Ext(indexFile)),
+	}
+}
+
+// Marshal serializes the sidecar.
+func (s Sidecar) Marshal() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "key: %s\n", s.Key)
+	if s.Version != "" {
+		fmt.Fprintf(&b, "version: %s\n", s.Version)
+	}
+	if s.Sha256Sum != "" {
+		fmt.Fprintf(&b, "sha256sum: %s\n", s.Sha256Sum)
+	}
+	return []byte(b.String())
+}
+
+// ReadSidecar deserializes the sidecar file.
+func ReadSidecar(name string) (Sidecar, error) {
+	var s Sidecar
+
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return s, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if err := yaml.Unmarshal(bb, &s); err != nil {
+		return s, fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+	}
+
+	return s, nil
+}
+
+// FileSha256 calculates the sha256sum of the file.
+func FileSha256(name string) (string, error) {
+	return archive.Sha256(context.Background(), name)
+}
+
+// BuildTime returns the time from the SOURCE_DATE_EPOCH environment variable
+// for reproducible builds, or the current time if it is not set.
+func BuildTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed SOURCE_DATE_EPOCH %q: %w", epoch, err)
+	}
+
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+var archiveNameRe = regexp.MustCompile(`^(.+)-(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?)\.tgz$`)
+
+// ParseArchiveName returns the module name and version of the archive file name.
+func ParseArchiveName(name string) (domain.NameVersionTuple, error) {
+	m := archiveNameRe.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return domain.NameVersionTuple{}, fmt.Errorf("malformed archive name %s, expected <name>-<version>.tgz", name)
+	}
+	return domain.NameVersionTuple{Name: m[1], Version: m[2]}, nil
+}
@@ -0,0 +1,143 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+// ChecksumFileName is the top-level file with sha256sums of all bundle files.
+const ChecksumFileName = "SHA256SUMS"
+
+type Config struct {
+	LogWriter io.Writer      // logger
+	Channel   config.Channel // channel to bundle
+	Output    string         // where archives are stored
+	File      string         // bundle file
+}
+
+// file is a single bundle entry.
+type file struct {
+	name string
+	data []byte
+}
+
+// Create writes a reproducible tar-gzip bundle with the channel index,
+// every module archive referenced by it, their sidecars and checksums.
+func Create(ctx context.Context, cfg Config) error {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	idx, err := index.Read(ctx, cfg.Channel.File)
+	if err != nil {
+		return err
+	}
+
+	indexData, err := os.ReadFile(cfg.Channel.File)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", cfg.Channel.File, err)
+	}
+
+	indexName := filepath.Base(cfg.Channel.File)
+	files := []file{
+		{name: indexName, data: indexData},
+		{name: indexName + artifact.SidecarSuffix, data: artifact.IndexSidecar(indexName).Marshal()},
+	}
+
+	var merr error
+	for _, m := range idx.Spec.Modules {
+		name := m.ArchiveName()
+		data, err := os.ReadFile(filepath.Join(cfg.Output, name))
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("module %s: %w", m, err))
+			continue
+		}
+
+		if shasum := sha256sum(data); shasum != m.Sha256Sum {
+			merr = errors.Join(merr, fmt.Errorf("module %s: archive sha256sum %s does not match index %s", m, shasum, m.Sha256Sum))
+			continue
+		}
+
+		l.Printf("Adding module %s", m)
+		files = append(files,
+			file{name: name, data: data},
+			file{name: name + artifact.SidecarSuffix, data: artifact.ModuleSidecar(m).Marshal()},
+		)
+	}
+
+	if merr != nil {
+		return fmt.Errorf("collecting archives failed: %w", merr)
+	}
+
+	slices.SortFunc(files, func(a, b file) int { return strings.Compare(a.name, b.name) })
+
+	var sums bytes.Buffer
+	for _, f := range files {
+		fmt.Fprintf(&sums, "%s  %s\n", sha256sum(f.data), f.name)
+	}
+	files = append([]file{{name: ChecksumFileName, data: sums.Bytes()}}, files...)
+
+	l.Printf("Writing bundle %s with %d files", cfg.File, len(files))
+	return writeTarGz(cfg.File, files)
+}
+
+func writeTarGz(name string, files []file) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	gw := gzip.NewWriter(tmpFile)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Size:     int64(len(f.data)),
+			Mode:     0o644,
+			ModTime:  time.Unix(0, 0),
+			Uname:    "root",
+			Gname:    "root",
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write header for %s: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return fmt.Errorf("failed to write %s into bundle: %w", f.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize tar: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize gzip: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmpFile.Name(), err)
+	}
+
+	return os.Rename(tmpFile.Name(), name)
+}
+
+func sha256sum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,222 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+// entry is a raw bundle entry, a regular file if the type is not set.
+type entry struct {
+	name     string
+	data     string
+	typeflag byte
+	linkname string
+}
+
+// writeBundle writes entries as is to a bundle file.
+func writeBundle(t *testing.T, entries ...entry) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "release-bundle.tar.gz")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		header := &tar.Header{Typeflag: e.typeflag, Name: e.name, Linkname: e.linkname, Mode: 0o644}
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(e.data))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// sums returns the checksum file entry listing the files.
+func sums(files ...entry) entry {
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "%s  %s\n", sha256sum([]byte(f.data)), f.name)
+	}
+	return entry{name: ChecksumFileName, data: b.String()}
+}
+
+func TestCreate(t *testing.T) {
+	output := t.TempDir()
+	archive := []byte("archive")
+	if err := os.WriteFile(filepath.Join(output, "ntp-1.0.0.tgz"), archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := config.Default().Channels[0]
+	ch.File = filepath.Join(output, ch.File)
+	var idx domain.HostOSConfigurationModules
+	idx.APIVersion = ch.APIVersion
+	idx.Kind = domain.HOCMKind
+	idx.Metadata.Name = ch.ObjectName
+	idx.Spec.Modules = []domain.Module{{
+		NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: "1.0.0"},
+		Sha256Sum:        sha256sum(archive),
+	}}
+	if err := index.Write(context.Background(), ch.File, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "release-bundle.tar.gz")
+	if err := Create(context.Background(), Config{LogWriter: io.Discard, Channel: ch, Output: output, File: name}); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	if err := Extract(ExtractConfig{LogWriter: io.Discard, File: name, Dest: dest, Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{ChecksumFileName, "index.yaml", "index.yaml.metadata.yaml", "ntp-1.0.0.tgz", "ntp-1.0.0.tgz.metadata.yaml"} {
+		if _, err := os.Stat(filepath.Join(dest, file)); err != nil {
+			t.Errorf("%s is not extracted: %v", file, err)
+		}
+	}
+}
+
+func TestExtractRejectsEntries(t *testing.T) {
+	for name, tc := range map[string]struct {
+		entries []entry
+		wantErr string
+	}{
+		"parent directory": {
+			entries: []entry{{name: "../x", data: "x"}},
+			wantErr: "unexpected entry path ../x",
+		},
+		"nested parent directory": {
+			entries: []entry{{name: "a/../../x", data: "x"}},
+			wantErr: "unexpected entry path a/../../x",
+		},
+		"absolute": {
+			entries: []entry{{name: "/tmp/x", data: "x"}},
+			wantErr: "unexpected entry path /tmp/x",
+		},
+		"subdirectory": {
+			entries: []entry{{name: "a/x", data: "x"}},
+			wantErr: "unexpected entry path a/x",
+		},
+		"symlink": {
+			entries: []entry{{name: "x", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}},
+			wantErr: "unexpected entry x of type 2",
+		},
+		"hardlink": {
+			entries: []entry{{name: "x", typeflag: tar.TypeLink, linkname: "../y"}},
+			wantErr: "unexpected entry x of type 1",
+		},
+		"directory": {
+			entries: []entry{{name: "x/", typeflag: tar.TypeDir}},
+			wantErr: "unexpected entry x/ of type 5",
+		},
+		"duplicate": {
+			entries: []entry{{name: "x", data: "x"}, {name: "x", data: "y"}},
+			wantErr: "duplicated entry x",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			dest := filepath.Join(root, "dest")
+			bundle := writeBundle(t, tc.entries...)
+
+			for _, verify := range []bool{true, false} {
+				err := Extract(ExtractConfig{LogWriter: io.Discard, File: bundle, Dest: dest, Verify: verify})
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("verify %t: expected error containing %q, got %v", verify, tc.wantErr, err)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(root, "x")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("entry is extracted outside of the destination: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	archive := entry{name: "ntp-1.0.0.tgz", data: "archive"}
+	idx := entry{name: "index.yaml", data: fmt.Sprintf("spec:\n  modules:\n  - name: ntp\n    version: 1.0.0\n    sha256sum: %s\n", sha256sum([]byte(archive.data)))}
+
+	for name, tc := range map[string]struct {
+		entries []entry
+		wantErr string
+		wantIs  error
+	}{
+		"valid": {
+			entries: []entry{sums(idx, archive), idx, archive},
+		},
+		"mismatched line": {
+			entries: []entry{sums(idx, entry{name: archive.name, data: "tampered"}), idx, archive},
+			wantErr: "ntp-1.0.0.tgz sha256sum",
+			wantIs:  ErrMismatch,
+		},
+		"missing line": {
+			entries: []entry{sums(idx), idx, archive},
+			wantErr: "ntp-1.0.0.tgz is not listed in SHA256SUMS",
+		},
+		"missing file": {
+			entries: []entry{sums(idx, archive), idx},
+			wantErr: "ntp-1.0.0.tgz is listed in SHA256SUMS but missing",
+		},
+		"malformed line": {
+			entries: []entry{{name: ChecksumFileName, data: "garbage\n"}},
+			wantErr: `malformed SHA256SUMS line "garbage"`,
+		},
+		"missing checksum file": {
+			entries: []entry{idx, archive},
+			wantErr: "SHA256SUMS is missing",
+		},
+		"archive differs from the index": {
+			entries: []entry{sums(idx, entry{name: archive.name, data: "tampered"}), idx, {name: archive.name, data: "tampered"}},
+			wantErr: "index.yaml: module ntp-1.0.0 sha256sum",
+			wantIs:  ErrMismatch,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := Verify(writeBundle(t, tc.entries...))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+			if tc.wantIs != nil && !errors.Is(err, tc.wantIs) {
+				t.Errorf("expected %v, got %v", tc.wantIs, err)
+			}
+		})
+	}
+}
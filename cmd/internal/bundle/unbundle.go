@@ -0,0 +1,192 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrMismatch is returned if a bundled file does not match its sha256sum.
+var ErrMismatch = errors.New("sha256sum mismatch")
+
+type ExtractConfig struct {
+	LogWriter io.Writer // logger
+	File      string    // bundle file
+	Dest      string    // directory to extract into
+	Verify    bool      // validate the bundle before extracting
+}
+
+// Extract unpacks the bundle into the destination directory.
+func Extract(cfg ExtractConfig) error {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	if cfg.Verify {
+		l.Printf("Verifying bundle %s", cfg.File)
+		if err := Verify(cfg.File); err != nil {
+			return fmt.Errorf("verification failed: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(cfg.Dest, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", cfg.Dest, err)
+	}
+
+	return walk(cfg.File, func(name string, r io.Reader) error {
+		target := filepath.Join(cfg.Dest, filepath.FromSlash(name))
+		l.Printf("Extracting %s", target)
+
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", target, err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("failed to write %s: %w", target, err)
+		}
+
+		return f.Close()
+	})
+}
+
+// Verify checks that every bundle file matches the checksum file,
+// and every archive referenced by bundled indexes matches its sha256sum.
+func Verify(name string) error {
+	var (
+		sums    []byte
+		hashes  = map[string]string{}
+		indexes = map[string][]byte{}
+	)
+	err := walk(name, func(name string, r io.Reader) error {
+		if name == ChecksumFileName {
+			var err error
+			sums, err = io.ReadAll(r)
+			return err
+		}
+
+		hash := sha256.New()
+		var buf bytes.Buffer
+		w := io.Writer(hash)
+		isIndex := strings.HasSuffix(name, ".yaml") && !strings.HasSuffix(name, artifact.SidecarSuffix)
+		if isIndex {
+			w = io.MultiWriter(hash, &buf)
+		}
+
+		if _, err := io.Copy(w, r); err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		hashes[name] = hex.EncodeToString(hash.Sum(nil))
+		if isIndex {
+			indexes[name] = buf.Bytes()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if sums == nil {
+		return fmt.Errorf("%s is missing", ChecksumFileName)
+	}
+
+	var merr error
+	listed := map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		sum, file, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			merr = errors.Join(merr, fmt.Errorf("malformed %s line %q", ChecksumFileName, scanner.Text()))
+			continue
+		}
+
+		listed[file] = struct{}{}
+		if got, exists := hashes[file]; !exists {
+			merr = errors.Join(merr, fmt.Errorf("%s is listed in %s but missing", file, ChecksumFileName))
+		} else if got != sum {
+			merr = errors.Join(merr, fmt.Errorf("%s sha256sum %s does not match %s: %w", file, got, sum, ErrMismatch))
+		}
+	}
+	for file := range hashes {
+		if _, ok := listed[file]; !ok {
+			merr = errors.Join(merr, fmt.Errorf("%s is not listed in %s", file, ChecksumFileName))
+		}
+	}
+
+	for name, data := range indexes {
+		var idx domain.HostOSConfigurationModules
+		if err := yaml.Unmarshal(data, &idx); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to deserialize data from %s: %w", name, err))
+			continue
+		}
+
+		for _, m := range idx.Spec.Modules {
+			if got, exists := hashes[m.ArchiveName()]; !exists {
+				merr = errors.Join(merr, fmt.Errorf("%s: archive of the module %s is missing", name, m))
+			} else if got != m.Sha256Sum {
+				merr = errors.Join(merr, fmt.Errorf("%s: module %s sha256sum %s does not match archive %s: %w", name, m, m.Sha256Sum, got, ErrMismatch))
+			}
+		}
+	}
+
+	return merr
+}
+
+// walk calls fn for every regular file of the bundle
+// rejecting entries which can escape the destination.
+func walk(name string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read gzip %s: %w", name, err)
+	}
+	defer gr.Close()
+
+	seen := map[string]struct{}{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar %s: %w", name, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected entry %s of type %c", header.Name, header.Typeflag)
+		}
+		if clean := path.Clean(header.Name); clean != header.Name || strings.Contains(clean, "/") || clean == ".." {
+			return fmt.Errorf("unexpected entry path %s", header.Name)
+		}
+		if _, dup := seen[header.Name]; dup {
+			return fmt.Errorf("duplicated entry %s", header.Name)
+		}
+		seen[header.Name] = struct{}{}
+
+		if err := fn(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
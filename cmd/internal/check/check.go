@@ -0,0 +1,316 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+	"github.com/Mirantis/host-os-modules/cmd/internal/indexdiff"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sort"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+// ErrDrift is returned if the rebuild does not match committed files.
+var ErrDrift = errors.New("committed files are not up to date")
+
+type Config struct {
+	LogWriter io.Writer        // logger
+	Dir       string           // git working tree relative paths are resolved in, the current directory if empty
+	Ref       string           // git revision to check, HEAD if empty
+	Dirs      []string         // module directories in the working tree
+	Channels  []config.Channel // channels in the working tree
+}
+
+// Kinds of problems.
+const (
+	KindNotBumped   = "not-bumped"  // archive differs but the version is the same
+	KindUncommitted = "uncommitted" // metadata version is bumped by the build
+	KindMissing     = "missing"     // built version is not listed in the index
+	KindStale       = "stale"       // listed version is not built anymore
+	KindUnsorted    = "unsorted"    // index is not sorted
+	KindMoved       = "moved"       // module is moved between channels
+	KindYanked      = "yanked"      // metadata version is withdrawn
+)
+
+type (
+	// Report lists problems found by the rebuild.
+	Report struct {
+		Ref      string    `json:"ref"`
+		Problems []Problem `json:"problems"`
+	}
+
+	// Problem is a single difference between the rebuild and committed files.
+	Problem struct {
+		Kind    string `json:"kind"`
+		Module  string `json:"module,omitempty"`
+		Channel string `json:"channel,omitempty"`
+		Message string `json:"message"`
+	}
+)
+
+// OK reports whether committed files match the rebuild.
+func (r Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Modules rebuilds modules of the git revision in a temporary worktree and
+// compares metadata versions, index entries and archive sha256sums with the
+// committed ones. Neither the working tree nor the working directory is modified.
+func Modules(ctx context.Context, cfg Config) (Report, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	report := Report{Ref: cfg.Ref, Problems: []Problem{}}
+	if report.Ref == "" {
+		report.Ref = "HEAD"
+	}
+
+	top, err := git.Run(cfg.Dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return report, err
+	}
+	top = strings.TrimSpace(top)
+
+	tmp, err := os.MkdirTemp("", "module-builder-check-")
+	if err != nil {
+		return report, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	worktree := filepath.Join(tmp, "worktree")
+	l.Printf("Checking out %s to %s", report.Ref, worktree)
+	if _, err := git.Run(top, "worktree", "add", "--detach", worktree, report.Ref); err != nil {
+		return report, err
+	}
+	defer func() {
+		if _, err := git.Run(top, "worktree", "remove", "--force", worktree); err != nil {
+			l.Printf("WARNING: failed to remove worktree %s: %v", worktree, err)
+		}
+	}()
+
+	dirs := make([]string, len(cfg.Dirs))
+	for i, dir := range cfg.Dirs {
+		if dirs[i], err = rebase(top, worktree, cfg.Dir, dir); err != nil {
+			return report, err
+		}
+	}
+
+	channels := make([]config.Channel, len(cfg.Channels))
+	committed := map[string][]domain.Module{}
+	for i, ch := range cfg.Channels {
+		channels[i] = ch
+		if channels[i].File, err = rebase(top, worktree, cfg.Dir, ch.File); err != nil {
+			return report, err
+		}
+
+		idx, err := index.Read(ctx, channels[i].File)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			continue // channel is not populated yet
+		case err != nil:
+			return report, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+		committed[ch.Name] = idx.Spec.Modules
+
+		_, err = sort.Index(sort.Config{LogWriter: cfg.LogWriter, Check: true, Files: []string{channels[i].File}})
+		switch {
+		case errors.Is(err, sort.ErrUnsorted):
+			report.add(Problem{
+				Kind:    KindUnsorted,
+				Channel: ch.Name,
+				Message: fmt.Sprintf("%s is not sorted; run sort", filepath.Base(ch.File)),
+			})
+		case err != nil:
+			return report, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+	}
+
+	output := filepath.Join(tmp, "artifacts")
+	if err := os.Mkdir(output, 0o755); err != nil {
+		return report, fmt.Errorf("failed to create %s: %w", output, err)
+	}
+
+	l.Printf("Rebuilding %d modules", len(dirs))
+	built, err := module.Build(ctx, module.Config{
+		LogWriter: cfg.LogWriter,
+		Dir:       worktree,
+		Output:    output,
+		Dirs:      dirs,
+		Channels:  channels,
+	})
+	if err != nil {
+		return report, fmt.Errorf("rebuild failed: %w", err)
+	}
+
+	names := map[string]bool{}
+	bumped := map[string]module.ModuleResult{}
+	for _, m := range built.Modules {
+		names[m.Name] = true
+		if m.OldVersion == m.NewVersion {
+			continue
+		}
+		bumped[m.Name] = m
+		report.add(Problem{
+			Kind:    KindUncommitted,
+			Module:  m.Name,
+			Message: fmt.Sprintf("%s metadata version %s is bumped to %s by the build; metadata not committed", m.Name, m.OldVersion, m.NewVersion),
+		})
+	}
+
+	for _, ch := range channels {
+		yanked(&report, ch, committed[ch.Name], built.Modules)
+	}
+
+	for _, ch := range channels {
+		idx, err := index.Read(ctx, ch.File)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+		diff := indexdiff.Modules(ch.Name, committed[ch.Name], idx.Spec.Modules)
+		explain(&report, ch, only(diff, names), bumped)
+	}
+
+	return report, nil
+}
+
+// explain adds problems of the index changed by the rebuild.
+func explain(report *Report, ch config.Channel, diff indexdiff.Report, bumped map[string]module.ModuleResult) {
+	file := filepath.Base(ch.File)
+
+	for _, c := range diff.Rehashed {
+		report.add(Problem{
+			Kind:    KindNotBumped,
+			Module:  c.Name,
+			Channel: ch.Name,
+			Message: fmt.Sprintf("%s archive sha differs; metadata not bumped (%s has %s %s, rebuilt %s)",
+				c.Name, file, c.Version, short(c.OldSha256Sum), short(c.Sha256Sum)),
+		})
+	}
+
+	for _, c := range diff.Added {
+		if _, ok := bumped[c.Name]; ok {
+			continue // already explained by the version bump
+		}
+		report.add(Problem{
+			Kind:    KindMissing,
+			Module:  c.Name,
+			Channel: ch.Name,
+			Message: fmt.Sprintf("%s %s is not listed in %s; index not rebuilt", c.Name, c.Version, file),
+		})
+	}
+
+	for _, c := range diff.Removed {
+		if _, ok := bumped[c.Name]; ok {
+			continue
+		}
+		report.add(Problem{
+			Kind:    KindStale,
+			Module:  c.Name,
+			Channel: ch.Name,
+			Message: fmt.Sprintf("%s %s is listed in %s but not built anymore; index not rebuilt", c.Name, c.Version, file),
+		})
+	}
+
+	for _, m := range diff.Moved {
+		report.add(Problem{
+			Kind:    KindMoved,
+			Module:  m.Name,
+			Channel: ch.Name,
+			Message: fmt.Sprintf("%s is moved from %s %s to %s %s by the build", m.Name, m.FromChannel, m.FromVersion, m.ToChannel, m.ToVersion),
+		})
+	}
+}
+
+// yanked adds problems of committed metadata versions withdrawn in the index.
+func yanked(report *Report, ch config.Channel, committed []domain.Module, built []module.ModuleResult) {
+	for _, m := range built {
+		for _, c := range committed {
+			if c.Name != m.Name || c.Version != m.OldVersion || !c.IsYanked() {
+				continue
+			}
+			report.add(Problem{
+				Kind:    KindYanked,
+				Module:  m.Name,
+				Channel: ch.Name,
+				Message: fmt.Sprintf("%s metadata version %s is yanked in %s (%s); bump the version", m.Name, m.OldVersion, filepath.Base(ch.File), c.YankReason),
+			})
+		}
+	}
+}
+
+// only drops changes of modules not rebuilt, e.g. removed
+// from a dev index rewritten with a subset of modules.
+func only(diff indexdiff.Report, names map[string]bool) indexdiff.Report {
+	keep := func(changes []indexdiff.Change) []indexdiff.Change {
+		var result []indexdiff.Change
+		for _, c := range changes {
+			if names[c.Name] {
+				result = append(result, c)
+			}
+		}
+		return result
+	}
+
+	diff.Added = keep(diff.Added)
+	diff.Removed = keep(diff.Removed)
+	diff.Rehashed = keep(diff.Rehashed)
+	return diff
+}
+
+func (r *Report) add(p Problem) {
+	r.Problems = append(r.Problems, p)
+}
+
+func short(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// rebase returns the path in the worktree corresponding to the path in the checkout,
+// relative paths are resolved in dir.
+func rebase(top, worktree, dir, name string) (string, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine abs path for the %s: %w", name, err)
+	}
+
+	// resolve symlinks, e.g. of the temporary directory, as git does
+	if resolved, err := filepath.EvalSymlinks(filepath.Dir(absName)); err == nil {
+		absName = filepath.Join(resolved, filepath.Base(absName))
+	}
+
+	rel, err := filepath.Rel(top, absName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is outside of the repository %s", name, top)
+	}
+
+	return filepath.Join(worktree, rel), nil
+}
+
+// WriteText writes problems in a human readable form.
+func (r Report) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, p := range r.Problems {
+		fmt.Fprintf(&buf, "%s\n", p.Message)
+	}
+	if r.OK() {
+		fmt.Fprintf(&buf, "%s is up to date.\n", r.Ref)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,186 @@
+package check
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git/gittest"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+const testMetadata = `name: %s
+description: 'Module for %s configuration'
+version: 1.0.1-dev
+valuesJsonSchema: schema.json
+docURL: https://example.com/%s/README.md
+playbook: main.yaml
+`
+
+// newTestRepo returns the repository with ntp and sysctl modules
+// committed together with the dev index listing them.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+
+	files := map[string]string{}
+	for _, name := range []string{"ntp", "sysctl"} {
+		files[name+"/metadata.yaml"] = strings.ReplaceAll(testMetadata, "%s", name)
+		files[name+"/main.yaml"] = "---\n"
+		files[name+"/schema.json"] = "{}\n"
+	}
+	repo := gittest.New(t, files)
+
+	if _, err := module.Build(context.Background(), module.Config{
+		LogWriter: io.Discard,
+		Dir:       repo,
+		Output:    t.TempDir(),
+		Dirs:      []string{"ntp", "sysctl"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	gittest.Commit(t, repo, "add modules to the dev index")
+	return repo
+}
+
+// updateIndex rewrites modules of the committed dev index.
+func updateIndex(t *testing.T, repo string, update func(modules []domain.Module) []domain.Module) {
+	t.Helper()
+
+	name := filepath.Join(repo, domain.DevIndexFileName)
+	idx, err := index.Read(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Spec.Modules = update(idx.Spec.Modules)
+	if err := index.Write(context.Background(), name, idx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	for name, tc := range map[string]struct {
+		change func(t *testing.T, repo string)
+
+		wantKinds   []string
+		wantMessage string
+	}{
+		"up to date": {
+			change: func(*testing.T, string) {},
+		},
+		"not bumped": {
+			change: func(t *testing.T, repo string) {
+				gittest.Write(t, repo, map[string]string{"ntp/main.yaml": "- hosts: all\n"})
+			},
+			wantKinds:   []string{KindNotBumped},
+			wantMessage: "ntp archive sha differs; metadata not bumped (index-dev.yaml has 1.0.1-dev ",
+		},
+		"missing": {
+			change: func(t *testing.T, repo string) {
+				updateIndex(t, repo, func(modules []domain.Module) []domain.Module { return modules[:1] })
+			},
+			wantKinds:   []string{KindMissing},
+			wantMessage: "sysctl 1.0.1-dev is not listed in index-dev.yaml; index not rebuilt",
+		},
+		"stale": {
+			change: func(t *testing.T, repo string) {
+				updateIndex(t, repo, func(modules []domain.Module) []domain.Module {
+					stale := modules[0]
+					stale.Version = "1.0.0-dev"
+					return append([]domain.Module{stale}, modules...)
+				})
+			},
+			wantKinds:   []string{KindStale},
+			wantMessage: "ntp 1.0.0-dev is listed in index-dev.yaml but not built anymore; index not rebuilt",
+		},
+		"unsorted": {
+			change: func(t *testing.T, repo string) {
+				updateIndex(t, repo, func(modules []domain.Module) []domain.Module {
+					return []domain.Module{modules[1], modules[0]}
+				})
+			},
+			wantKinds:   []string{KindUnsorted},
+			wantMessage: "index-dev.yaml is not sorted; run sort",
+		},
+		"yanked": {
+			change: func(t *testing.T, repo string) {
+				updateIndex(t, repo, func(modules []domain.Module) []domain.Module {
+					yankedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+					modules[0].YankReason = "CVE-2026-0001"
+					modules[0].YankedAt = &yankedAt
+					return modules
+				})
+			},
+			wantKinds:   []string{KindYanked},
+			wantMessage: "ntp metadata version 1.0.1-dev is yanked in index-dev.yaml (CVE-2026-0001); bump the version",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := newTestRepo(t)
+			tc.change(t, repo)
+			head := gittest.Commit(t, repo, name)
+
+			files := map[string][]byte{}
+			for _, name := range []string{domain.DevIndexFileName, "ntp/metadata.yaml", "sysctl/metadata.yaml"} {
+				bb, err := os.ReadFile(filepath.Join(repo, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				files[name] = bb
+			}
+
+			report, err := Modules(context.Background(), Config{
+				LogWriter: io.Discard,
+				Dir:       repo,
+				Dirs:      []string{"ntp", "sysctl"},
+				Channels:  config.Default().Channels,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var kinds []string
+			var messages strings.Builder
+			for _, p := range report.Problems {
+				kinds = append(kinds, p.Kind)
+				messages.WriteString(p.Message + "\n")
+			}
+			if !slices.Equal(kinds, tc.wantKinds) {
+				t.Errorf("expected problems %v, got:\n%s", tc.wantKinds, &messages)
+			}
+			if !strings.Contains(messages.String(), tc.wantMessage) {
+				t.Errorf("expected problem %q, got:\n%s", tc.wantMessage, &messages)
+			}
+			if report.Ref != "HEAD" || report.OK() != (len(tc.wantKinds) == 0) {
+				t.Errorf("unexpected report %+v", report)
+			}
+
+			// the checkout is untouched
+			if status := gittest.Run(t, repo, "status", "--porcelain"); status != "" {
+				t.Errorf("unexpected working tree status %q", status)
+			}
+			if got := gittest.Run(t, repo, "rev-parse", "HEAD"); got != head {
+				t.Errorf("expected HEAD %s, got %s", head, got)
+			}
+			if worktrees := gittest.Run(t, repo, "worktree", "list", "--porcelain"); strings.Count(worktrees, "worktree ") != 1 {
+				t.Errorf("temporary worktree is not removed:\n%s", worktrees)
+			}
+			for name, want := range files {
+				bb, err := os.ReadFile(filepath.Join(repo, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(bb) != string(want) {
+					t.Errorf("%s is modified:\n%s", name, bb)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FileName is the default name of the repo-level configuration file.
+	FileName = "module-builder.yaml"
+
+	// DefaultDocURLBase is the URL upstream module READMEs are published under.
+	DefaultDocURLBase = "https://github.com/Mirantis/host-os-modules/blob/main"
+)
+
+// Stage determines how a channel is updated by the builder.
+type Stage string
+
+const (
+	// StageDev channels contain only the latest prerelease versions
+	// of modules and are rewritten on every build.
+	StageDev Stage = "dev"
+	// StageRelease channels accumulate released versions of modules
+	// and are updated only on promotion.
+	StageRelease Stage = "release"
+)
+
+type (
+	// Config represents the module-builder.yaml file.
+	Config struct {
+		Channels []Channel `yaml:"channels"`
+
+		// DocURLBase is the URL module READMEs are published under,
+		// the docURL of a new module is <base>/<name>/README.md.
+		DocURLBase string `yaml:"docURLBase,omitempty"`
+	}
+
+	// Channel is a single index file with the HostOSConfigurationModules object.
+	Channel struct {
+		Name       string `yaml:"name"`
+		File       string `yaml:"file"`       // path relative to the config file
+		ObjectName string `yaml:"objectName"` // HostOSConfigurationModules object name
+		APIVersion string `yaml:"apiVersion,omitempty"`
+		Stage      Stage  `yaml:"stage"`
+
+		// Modules and Versions route modules into the channel, any module
+		// and any version of the channel stage is accepted if empty.
+		Modules  []string `yaml:"modules,omitempty"`
+		Versions string   `yaml:"versions,omitempty"` // semver constraint
+
+		// Enrich adds module metadata and archive size to index entries.
+		Enrich bool `yaml:"enrich,omitempty"`
+	}
+)
+
+// Default returns the configuration with the upstream
+// index.yaml and index-dev.yaml channels.
+func Default() *Config {
+	return &Config{
+		DocURLBase: DefaultDocURLBase,
+		Channels: []Channel{
+			{
+				Name:       "release",
+				File:       domain.ReleaseIndexFileName,
+				ObjectName: domain.ReleaseHOCMObjName,
+				APIVersion: domain.HOCMAPIVersion,
+				Stage:      StageRelease,
+			},
+			{
+				Name:       "dev",
+				File:       domain.DevIndexFileName,
+				ObjectName: domain.DevHOCMObjName,
+				APIVersion: domain.HOCMAPIVersion,
+				Stage:      StageDev,
+			},
+		},
+	}
+}
+
+// Load reads the configuration from the file, index file paths are
+// resolved relative to its directory. If the file does not exist,
+// the default configuration relative to the current directory is returned.
+func Load(name string) (*Config, error) {
+	cfg := Default()
+	baseDir := "."
+
+	bb, err := os.ReadFile(name)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	default:
+		cfg = &Config{}
+		if err := yaml.Unmarshal(bb, cfg); err != nil {
+			return nil, fmt.Errorf("failed to deserialize %s: %w", name, err)
+		}
+		baseDir = filepath.Dir(name)
+	}
+
+	if err := cfg.init(baseDir); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", name, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) init(baseDir string) error {
+	if len(c.Channels) == 0 {
+		return errors.New("no channels defined")
+	}
+
+	if c.DocURLBase == "" {
+		c.DocURLBase = DefaultDocURLBase
+	}
+
+	var merr error
+	for i := range c.Channels {
+		ch := &c.Channels[i]
+		if ch.Name == "" || ch.File == "" || ch.ObjectName == "" {
+			merr = errors.Join(merr, fmt.Errorf("channel #%d: name, file and objectName are required", i))
+			continue
+		}
+
+		if slices.IndexFunc(c.Channels[:i], func(o Channel) bool { return o.Name == ch.Name }) >= 0 {
+			merr = errors.Join(merr, fmt.Errorf("channel %s: duplicated name", ch.Name))
+		}
+
+		if ch.Stage != StageDev && ch.Stage != StageRelease {
+			merr = errors.Join(merr, fmt.Errorf("channel %s: stage must be one of [%s, %s], given %q", ch.Name, StageDev, StageRelease, ch.Stage))
+		}
+
+		if ch.APIVersion == "" {
+			ch.APIVersion = domain.HOCMAPIVersion
+		}
+
+		if _, err := ch.constraints(); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("channel %s: %w", ch.Name, err))
+		}
+
+		if !filepath.IsAbs(ch.File) {
+			absFile, err := filepath.Abs(filepath.Join(baseDir, ch.File))
+			if err != nil {
+				return fmt.Errorf("failed to determine abs path for the %s: %w", ch.File, err)
+			}
+			ch.File = absFile
+		}
+	}
+
+	return merr
+}
+
+// Channel returns the channel by its name.
+func (c *Config) Channel(name string) (Channel, error) {
+	for _, ch := range c.Channels {
+		if ch.Name == name {
+			return ch, nil
+		}
+	}
+	return Channel{}, fmt.Errorf("unknown channel %q", name)
+}
+
+// Files returns index file paths of all channels.
+func (c *Config) Files() []string {
+	files := make([]string, len(c.Channels))
+	for i, ch := range c.Channels {
+		files[i] = ch.File
+	}
+	return files
+}
+
+// Accepts reports whether the module version is routed to the channel.
+// An error is returned if the versions constraint of the channel is malformed.
+func (c Channel) Accepts(t domain.NameVersionTuple) (bool, error) {
+	constraints, err := c.constraints()
+	if err != nil {
+		return false, err
+	}
+
+	if len(c.Modules) > 0 && !slices.Contains(c.Modules, t.Name) {
+		return false, nil
+	}
+
+	v, err := semver.NewVersion(t.Version)
+	if err != nil {
+		return false, nil
+	}
+
+	if isPrerelease := v.Prerelease() != ""; isPrerelease != (c.Stage == StageDev) {
+		return false, nil
+	}
+
+	if constraints != nil {
+		// routing is based on the version core only
+		core := semver.New(v.Major(), v.Minor(), v.Patch(), "", "")
+		return constraints.Check(core), nil
+	}
+
+	return true, nil
+}
+
+// Filter returns modules routed to the channel,
+// optional fields are dropped unless the channel is enriched.
+func (c Channel) Filter(modules []domain.Module) ([]domain.Module, error) {
+	result := []domain.Module{}
+	for _, m := range modules {
+		ok, err := c.Accepts(m.NameVersionTuple)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if !c.Enrich {
+			m = m.Minimal()
+		}
+		result = append(result, m)
+	}
+	return slices.Clip(result), nil
+}
+
+// constraints parses the versions constraint, nil if it is empty.
+func (c Channel) constraints() (*semver.Constraints, error) {
+	if c.Versions == "" {
+		return nil, nil
+	}
+
+	constraints, err := semver.NewConstraint(c.Versions)
+	if err != nil {
+		return nil, fmt.Errorf("malformed versions constraint: %w", err)
+	}
+	return constraints, nil
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+const testConfig = `channels:
+  - name: release
+    file: index.yaml
+    objectName: mcc-modules
+    stage: release
+  - name: lts
+    file: indexes/index-lts.yaml
+    objectName: lts-modules
+    stage: release
+    versions: "~1.1"
+    modules: [ntp, auditd]
+  - name: dev
+    file: index-dev.yaml
+    objectName: dev-mcc-modules
+    stage: dev
+    enrich: true
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, FileName)
+	if err := os.WriteFile(name, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lts, err := cfg.Channel("lts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "indexes", "index-lts.yaml"); lts.File != want {
+		t.Errorf("file %s, want %s", lts.File, want)
+	}
+	if lts.APIVersion != domain.HOCMAPIVersion {
+		t.Errorf("apiVersion %s, want the default", lts.APIVersion)
+	}
+	if cfg.DocURLBase != DefaultDocURLBase {
+		t.Errorf("docURLBase %s, want the default", cfg.DocURLBase)
+	}
+
+	if _, err := cfg.Channel("unknown"); err == nil {
+		t.Error("unknown channel: expected error")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"no channels":         "channels: []\n",
+		"missing object name": "channels:\n  - name: dev\n    file: index-dev.yaml\n    stage: dev\n",
+		"unknown stage":       "channels:\n  - name: dev\n    file: index-dev.yaml\n    objectName: dev\n    stage: beta\n",
+		"malformed versions":  "channels:\n  - name: dev\n    file: index-dev.yaml\n    objectName: dev\n    stage: dev\n    versions: '>>1'\n",
+		"duplicated name": "channels:\n  - name: dev\n    file: a.yaml\n    objectName: a\n    stage: dev\n" +
+			"  - name: dev\n    file: b.yaml\n    objectName: b\n    stage: dev\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), FileName)
+			if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(file); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestChannelAccepts(t *testing.T) {
+	// channels are not initialized by Load to check they route on their own
+	var (
+		release = Channel{Name: "release", Stage: StageRelease}
+		dev     = Channel{Name: "dev", Stage: StageDev}
+		lts     = Channel{Name: "lts", Stage: StageRelease, Versions: "~1.1", Modules: []string{"ntp"}}
+		ltsDev  = Channel{Name: "lts-dev", Stage: StageDev, Versions: "~1.1"}
+	)
+
+	for _, tc := range []struct {
+		ch      Channel
+		module  string
+		version string
+		want    bool
+	}{
+		{release, "ntp", "1.1.0", true},
+		{release, "ntp", "1.1.1-dev", false},
+		{release, "ntp", "not-a-version", false},
+		{dev, "ntp", "1.1.1-dev", true},
+		{dev, "ntp", "1.1.0", false},
+		{lts, "ntp", "1.1.3", true},
+		{lts, "ntp", "1.2.0", false},
+		{lts, "auditd", "1.1.3", false},
+		{ltsDev, "ntp", "1.1.4-dev", true}, // the prerelease is ignored by the constraint
+		{ltsDev, "ntp", "1.2.1-dev", false},
+	} {
+		got, err := tc.ch.Accepts(domain.NameVersionTuple{Name: tc.module, Version: tc.version})
+		if err != nil {
+			t.Fatalf("%s %s-%s: %v", tc.ch.Name, tc.module, tc.version, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s accepts %s-%s: %t, want %t", tc.ch.Name, tc.module, tc.version, got, tc.want)
+		}
+	}
+
+	malformed := Channel{Name: "malformed", Stage: StageRelease, Versions: ">>1"}
+	if _, err := malformed.Accepts(domain.NameVersionTuple{Name: "ntp", Version: "1.0.0"}); err == nil {
+		t.Error("malformed constraint: expected error")
+	}
+	if _, err := malformed.Filter([]domain.Module{{NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: "1.0.0"}}}); err == nil {
+		t.Error("malformed constraint: expected filter error")
+	}
+}
+
+func TestChannelFilter(t *testing.T) {
+	modules := []domain.Module{
+		{NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: "1.1.0"}, Sha256Sum: "a", Description: "NTP", Size: 10},
+		{NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: "1.1.1-dev"}, Sha256Sum: "b", Description: "NTP", Size: 20},
+	}
+
+	got, err := Channel{Name: "release", Stage: StageRelease}.Filter(modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Version != "1.1.0" || got[0].Description != "" || got[0].Size != 0 {
+		t.Errorf("release filter: %+v", got)
+	}
+
+	got, err = Channel{Name: "dev", Stage: StageDev, Enrich: true}.Filter(modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Version != "1.1.1-dev" || got[0].Description != "NTP" || got[0].Size != 20 {
+		t.Errorf("enriched dev filter: %+v", got)
+	}
+
+	if !slices.Equal(Default().Files(), []string{domain.ReleaseIndexFileName, domain.DevIndexFileName}) {
+		t.Errorf("default files %v", Default().Files())
+	}
+}
@@ -1,8 +0,0 @@
-package domain
-
-const (
-	ReleaseIndexFileName = "index.yaml"
-	DevIndexFileName     = "index-dev.yaml"
-	DevHOCMObjName       = "dev-mcc-modules"
-	ReleaseHOCMObjName   = "mcc-modules"
-)
@@ -0,0 +1,27 @@
+// Package git runs git commands in module repositories.
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Run executes git with the arguments in the directory, the current one
+// if empty, and returns its standard output. The output is returned on
+// failure as well, e.g. of git diff --exit-code, while the standard error
+// is a part of the error.
+func Run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return string(output), fmt.Errorf("failed execution of the '%s' command: %w: %s", cmd.String(), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(output), nil
+}
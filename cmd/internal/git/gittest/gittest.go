@@ -0,0 +1,74 @@
+// Package gittest provides temporary git repositories for tests.
+package gittest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+)
+
+// New creates a git repository in a temporary directory and commits
+// the files given by their slash-separated names relative to the repository.
+// The repository is configured with the test identity, so commits made by
+// the code under test succeed as well. The test is skipped if git is not installed.
+func New(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// resolve symlinks, e.g. of the temporary directory, as git does
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Run(t, dir, "init", "--quiet")
+	Run(t, dir, "config", "user.name", "test")
+	Run(t, dir, "config", "user.email", "test@example.com")
+	Run(t, dir, "config", "commit.gpgsign", "false")
+	Write(t, dir, files)
+	Commit(t, dir, "initial commit")
+	return dir
+}
+
+// Write writes the files given by their slash-separated names
+// relative to the repository.
+func Write(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Commit commits all changes of the repository and returns the commit hash.
+func Commit(t testing.TB, dir, msg string) string {
+	t.Helper()
+
+	Run(t, dir, "add", "--all")
+	Run(t, dir, "commit", "--quiet", "--allow-empty", "-m", msg)
+	return Run(t, dir, "rev-parse", "HEAD")
+}
+
+// Run executes git in the repository and returns its trimmed output.
+func Run(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+
+	output, err := git.Run(dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(output)
+}
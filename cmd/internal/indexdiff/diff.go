@@ -0,0 +1,378 @@
+package indexdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	LogWriter io.Writer        // logger
+	Dir       string           // git working tree, the current directory if empty
+	Channels  []config.Channel // channels to compare for git revisions
+	RefA      string           // old side, HEAD if empty
+	RefB      string           // new side, working tree if empty
+}
+
+type (
+	// Report lists differences between two sets of indexes.
+	Report struct {
+		Added    []Change `json:"added"`
+		Removed  []Change `json:"removed"`
+		Rehashed []Change `json:"rehashed"`
+		Moved    []Move   `json:"moved"`
+	}
+
+	// Change is a module added, removed or re-hashed in a channel.
+	Change struct {
+		Channel      string `json:"channel"`
+		Name         string `json:"name"`
+		Version      string `json:"version"`
+		Sha256Sum    string `json:"sha256sum"`
+		OldSha256Sum string `json:"oldSha256sum,omitempty"`
+	}
+
+	// Move is a module removed from a dev channel and added
+	// to a release one, e.g. during the promotion.
+	Move struct {
+		Name        string `json:"name"`
+		FromChannel string `json:"fromChannel"`
+		FromVersion string `json:"fromVersion"`
+		ToChannel   string `json:"toChannel"`
+		ToVersion   string `json:"toVersion"`
+	}
+)
+
+// IsEmpty reports whether there are no differences.
+func (r Report) IsEmpty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Rehashed) == 0 && len(r.Moved) == 0
+}
+
+// snapshot is a set of indexes keyed by channel name.
+type snapshot map[string][]domain.Module
+
+// fileChannel is a key for a single index file given explicitly.
+const fileChannel = "file"
+
+// Indexes compares indexes from two git revisions or two files.
+// A reference is either a git revision to load every channel from,
+// a path to an index file, or a <revision>:<path> index file in git.
+// If only an index file is given, it is compared with its working tree
+// version, or its HEAD version is compared with it if the file is
+// in the working tree.
+func Indexes(cfg Config) (Report, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	refA, refB := cfg.RefA, cfg.RefB
+	if refA == "" {
+		refA = "HEAD"
+	}
+	if refB == "" {
+		var err error
+		if refA, refB, err = workingTreeRefs(cfg.Dir, refA); err != nil {
+			return Report{}, err
+		}
+	}
+
+	l.Printf("Loading indexes from %s", refA)
+	a, aIsFile, err := load(cfg.Dir, cfg.Channels, refA)
+	if err != nil {
+		return Report{}, err
+	}
+
+	l.Printf("Loading indexes from %s", describe(refB))
+	b, bIsFile, err := load(cfg.Dir, cfg.Channels, refB)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if aIsFile != bIsFile {
+		return Report{}, fmt.Errorf("can not compare %s with %s: both refs must be either index files or git revisions, "+
+			"use <revision>:<path> to refer to an index file in git", refA, describe(refB))
+	}
+
+	return compare(cfg.Channels, a, b), nil
+}
+
+func describe(ref string) string {
+	if ref == "" {
+		return "the working tree"
+	}
+	return ref
+}
+
+// workingTreeRefs returns refs comparing the index file given by the ref
+// with its working tree version. The ref is returned as is with the empty
+// new side, i.e. the working tree, if it is not an index file.
+func workingTreeRefs(dir, ref string) (string, string, error) {
+	// working tree file is compared with its HEAD version
+	if stat, err := os.Stat(ref); err == nil && !stat.IsDir() {
+		rel, err := relPath(dir, ref)
+		if err != nil {
+			return "", "", err
+		}
+		return "HEAD:./" + filepath.ToSlash(rel), ref, nil
+	}
+
+	_, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		return ref, "", nil
+	}
+
+	// the path is relative to the repository root unless it starts with ./ or ../
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+	} else {
+		top, err := git.Run(dir, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return "", "", fmt.Errorf("failed to determine the repository root: %w", err)
+		}
+		name = filepath.Join(strings.TrimSpace(top), filepath.FromSlash(name))
+	}
+
+	if _, err := os.Stat(name); err != nil {
+		return "", "", fmt.Errorf("index file of %s in the working tree: %w", ref, err)
+	}
+	return ref, name, nil
+}
+
+func load(dir string, channels []config.Channel, ref string) (snapshot, bool, error) {
+	// single index file either in git or in the working tree
+	if stat, err := os.Stat(ref); ref != "" && err == nil && !stat.IsDir() {
+		bb, err := os.ReadFile(ref)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to read %s: %w", ref, err)
+		}
+		modules, err := decode(ref, bb)
+		return snapshot{fileChannel: modules}, true, err
+	}
+	if strings.Contains(ref, ":") {
+		bb, err := gitShow(dir, ref)
+		if err != nil {
+			return nil, true, err
+		}
+		modules, err := decode(ref, bb)
+		return snapshot{fileChannel: modules}, true, err
+	}
+
+	s := snapshot{}
+	for _, ch := range channels {
+		var (
+			bb  []byte
+			err error
+		)
+		if ref == "" {
+			bb, err = os.ReadFile(ch.File)
+		} else {
+			bb, err = gitShowFile(dir, ref, ch.File)
+		}
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errNotInGit) {
+			s[ch.Name] = nil // channel is introduced or dropped
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+
+		if s[ch.Name], err = decode(ch.File, bb); err != nil {
+			return nil, false, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+	}
+
+	return s, false, nil
+}
+
+var errNotInGit = errors.New("path does not exist in git")
+
+// gitShowFile returns contents of the file at the git revision.
+func gitShowFile(dir, rev, name string) ([]byte, error) {
+	rel, err := relPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return gitShow(dir, rev+":./"+filepath.ToSlash(rel))
+}
+
+// relPath returns the path of the file relative to the git working tree,
+// the current directory if empty.
+func relPath(dir, name string) (string, error) {
+	wd, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine abs path for the %s: %w", dir, err)
+	}
+
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine abs path for the %s: %w", name, err)
+	}
+
+	rel, err := filepath.Rel(wd, absName)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine relative path for the %s: %w", name, err)
+	}
+	return rel, nil
+}
+
+func gitShow(dir, object string) ([]byte, error) {
+	output, err := git.Run(dir, "show", object)
+	if err != nil {
+		// the error contains the standard error of git
+		if msg := err.Error(); strings.Contains(msg, "does not exist") || strings.Contains(msg, "exists on disk, but not in") {
+			return nil, fmt.Errorf("%s: %w", object, errNotInGit)
+		}
+		return nil, err
+	}
+
+	return []byte(output), nil
+}
+
+// Modules compares two module lists of the same channel.
+func Modules(channel string, a, b []domain.Module) Report {
+	return compare(nil, snapshot{channel: a}, snapshot{channel: b})
+}
+
+func decode(name string, bb []byte) ([]domain.Module, error) {
+	var index domain.HostOSConfigurationModules
+	if err := yaml.Unmarshal(bb, &index); err != nil {
+		return nil, fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+	}
+	return index.Spec.Modules, nil
+}
+
+func compare(channels []config.Channel, a, b snapshot) Report {
+	var r Report
+
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	for _, channel := range names {
+		old := map[domain.NameVersionTuple]domain.Module{}
+		for _, m := range a[channel] {
+			old[m.NameVersionTuple] = m
+		}
+		cur := map[domain.NameVersionTuple]domain.Module{}
+		for _, m := range b[channel] {
+			cur[m.NameVersionTuple] = m
+		}
+
+		for _, m := range b[channel] {
+			o, exists := old[m.NameVersionTuple]
+			switch {
+			case !exists:
+				r.Added = append(r.Added, change(channel, m))
+			case o.Sha256Sum != m.Sha256Sum:
+				c := change(channel, m)
+				c.OldSha256Sum = o.Sha256Sum
+				r.Rehashed = append(r.Rehashed, c)
+			}
+		}
+		for _, m := range a[channel] {
+			if _, exists := cur[m.NameVersionTuple]; !exists {
+				r.Removed = append(r.Removed, change(channel, m))
+			}
+		}
+	}
+
+	r = detectMoves(channels, r)
+
+	// sanity for serialization
+	for _, changes := range []*[]Change{&r.Added, &r.Removed, &r.Rehashed} {
+		if *changes == nil {
+			*changes = []Change{}
+		}
+	}
+	if r.Moved == nil {
+		r.Moved = []Move{}
+	}
+
+	return r
+}
+
+// detectMoves replaces a pair of the module removed from a dev channel
+// and added to a release channel with a single move.
+func detectMoves(channels []config.Channel, r Report) Report {
+	stages := map[string]config.Stage{}
+	for _, ch := range channels {
+		stages[ch.Name] = ch.Stage
+	}
+
+	var removed []Change
+	for _, rm := range r.Removed {
+		if stages[rm.Channel] != config.StageDev {
+			removed = append(removed, rm)
+			continue
+		}
+
+		i := slices.IndexFunc(r.Added, func(c Change) bool {
+			return c.Name == rm.Name && stages[c.Channel] == config.StageRelease
+		})
+		if i < 0 {
+			removed = append(removed, rm)
+			continue
+		}
+
+		r.Moved = append(r.Moved, Move{
+			Name:        rm.Name,
+			FromChannel: rm.Channel,
+			FromVersion: rm.Version,
+			ToChannel:   r.Added[i].Channel,
+			ToVersion:   r.Added[i].Version,
+		})
+		r.Added = slices.Delete(r.Added, i, i+1)
+	}
+	r.Removed = removed
+
+	return r
+}
+
+func change(channel string, m domain.Module) Change {
+	return Change{
+		Channel:   channel,
+		Name:      m.Name,
+		Version:   m.Version,
+		Sha256Sum: m.Sha256Sum,
+	}
+}
+
+// WriteText writes the report in a human readable form.
+func (r Report) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, c := range r.Added {
+		fmt.Fprintf(&buf, "%s: added %s-%s (sha256sum %s)\n", c.Channel, c.Name, c.Version, c.Sha256Sum)
+	}
+	for _, c := range r.Removed {
+		fmt.Fprintf(&buf, "%s: removed %s-%s (sha256sum %s)\n", c.Channel, c.Name, c.Version, c.Sha256Sum)
+	}
+	for _, c := range r.Rehashed {
+		fmt.Fprintf(&buf, "%s: re-hashed %s-%s (sha256sum %s -> %s)\n", c.Channel, c.Name, c.Version, c.OldSha256Sum, c.Sha256Sum)
+	}
+	for _, m := range r.Moved {
+		fmt.Fprintf(&buf, "moved %s: %s %s -> %s %s\n", m.Name, m.FromChannel, m.FromVersion, m.ToChannel, m.ToVersion)
+	}
+	if r.IsEmpty() {
+		buf.WriteString("No differences.\n")
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,124 @@
+package indexdiff
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git/gittest"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+func module(name, version, sha string) domain.Module {
+	return domain.Module{NameVersionTuple: domain.NameVersionTuple{Name: name, Version: version}, Sha256Sum: sha}
+}
+
+// indexYAML returns the index listing the modules.
+func indexYAML(modules ...domain.Module) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: kaas.mirantis.com/v1alpha1\nkind: HostOSConfigurationModules\nspec:\n  modules:\n")
+	for _, m := range modules {
+		fmt.Fprintf(&b, "  - name: %s\n    version: %s\n    sha256sum: %s\n", m.Name, m.Version, m.Sha256Sum)
+	}
+	return b.String()
+}
+
+func TestModules(t *testing.T) {
+	a := []domain.Module{
+		module("auditd", "1.0.0", "aaa"),
+		module("ntp", "1.0.0", "bbb"),
+		module("sysctl", "1.0.0", "ccc"),
+	}
+	b := []domain.Module{
+		module("auditd", "1.0.0", "aaa"),
+		module("ntp", "1.0.0", "ddd"),
+		module("ntp", "1.1.0", "eee"),
+	}
+
+	want := Report{
+		Added:    []Change{{Channel: "release", Name: "ntp", Version: "1.1.0", Sha256Sum: "eee"}},
+		Removed:  []Change{{Channel: "release", Name: "sysctl", Version: "1.0.0", Sha256Sum: "ccc"}},
+		Rehashed: []Change{{Channel: "release", Name: "ntp", Version: "1.0.0", Sha256Sum: "ddd", OldSha256Sum: "bbb"}},
+		Moved:    []Move{},
+	}
+	if got := Modules("release", a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if got := Modules("release", a, a); !got.IsEmpty() {
+		t.Errorf("expected no differences, got %+v", got)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	repo := gittest.New(t, map[string]string{
+		"index.yaml":     indexYAML(module("auditd", "1.0.0", "aaa")),
+		"index-dev.yaml": indexYAML(module("ntp", "1.0.1-dev", "bbb"), module("sysctl", "1.0.1-dev", "ccc")),
+	})
+
+	// ntp is promoted, sysctl is dropped and auditd is rebuilt
+	gittest.Write(t, repo, map[string]string{
+		"index.yaml":     indexYAML(module("auditd", "1.0.0", "ddd"), module("ntp", "1.1.0", "eee")),
+		"index-dev.yaml": indexYAML(),
+	})
+	gittest.Commit(t, repo, "promote")
+
+	channels := config.Default().Channels
+	for i := range channels {
+		channels[i].File = filepath.Join(repo, channels[i].File)
+	}
+
+	want := Report{
+		Added:    []Change{},
+		Removed:  []Change{{Channel: "dev", Name: "sysctl", Version: "1.0.1-dev", Sha256Sum: "ccc"}},
+		Rehashed: []Change{{Channel: "release", Name: "auditd", Version: "1.0.0", Sha256Sum: "ddd", OldSha256Sum: "aaa"}},
+		Moved:    []Move{{Name: "ntp", FromChannel: "dev", FromVersion: "1.0.1-dev", ToChannel: "release", ToVersion: "1.1.0"}},
+	}
+
+	for name, cfg := range map[string]Config{
+		"working tree": {RefA: "HEAD~1"},
+		"revisions":    {RefA: "HEAD~1", RefB: "HEAD"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg.LogWriter = io.Discard
+			cfg.Dir = repo
+			cfg.Channels = channels
+
+			got, err := Indexes(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+
+	t.Run("index file", func(t *testing.T) {
+		got, err := Indexes(Config{LogWriter: io.Discard, Dir: repo, RefA: "HEAD~1:index.yaml"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Rehashed) != 1 || len(got.Added) != 1 || got.Added[0].Name != "ntp" {
+			t.Errorf("unexpected report %+v", got)
+		}
+	})
+
+	t.Run("file and revision", func(t *testing.T) {
+		_, err := Indexes(Config{LogWriter: io.Discard, Dir: repo, Channels: channels, RefA: channels[0].File, RefB: "HEAD"})
+		if err == nil || !strings.Contains(err.Error(), "both refs must be either index files or git revisions") {
+			t.Fatalf("expected error comparing a file with a revision, got %v", err)
+		}
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		_, err := Indexes(Config{LogWriter: io.Discard, Dir: repo, RefA: "HEAD:./missing.yaml", RefB: "HEAD:./index.yaml"})
+		if err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+			t.Fatalf("expected error containing the missing path, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package manifests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+const (
+	// ManagedByLabel marks objects rendered by the builder.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	annotationPrefix         = "module-builder.mirantis.com/"
+	BuilderVersionAnnotation = annotationPrefix + "version"
+	GitCommitAnnotation      = annotationPrefix + "git-commit"
+	BuildTimeAnnotation      = annotationPrefix + "build-time"
+
+	// KustomizationFileName is the name of the kustomization put next to the output.
+	KustomizationFileName = "kustomization.yaml"
+)
+
+type Config struct {
+	LogWriter     io.Writer         // logger
+	Channels      []config.Channel  // channels to render
+	Labels        map[string]string // labels of every object
+	Annotations   map[string]string // annotations of every object
+	Output        string            // multi-document manifests file
+	Kustomization bool              // put the kustomization.yaml referring to the output next to it
+
+	// Build details put to annotations, omitted if empty.
+	BuilderVersion string
+	GitCommit      string
+	BuildTime      time.Time
+}
+
+// Render wraps channel indexes into objects with labels and annotations
+// and writes them to the output file if it is set.
+func Render(ctx context.Context, cfg Config) ([]domain.HostOSConfigurationModules, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	if cfg.Kustomization && cfg.Output == "" {
+		return nil, errors.New("output file is required to emit the kustomization")
+	}
+
+	labels := map[string]string{ManagedByLabel: "module-builder"}
+	maps.Copy(labels, cfg.Labels)
+
+	annotations := map[string]string{}
+	if cfg.BuilderVersion != "" {
+		annotations[BuilderVersionAnnotation] = cfg.BuilderVersion
+	}
+	if cfg.GitCommit != "" {
+		annotations[GitCommitAnnotation] = cfg.GitCommit
+	}
+	if !cfg.BuildTime.IsZero() {
+		annotations[BuildTimeAnnotation] = cfg.BuildTime.UTC().Format(time.RFC3339)
+	}
+	maps.Copy(annotations, cfg.Annotations)
+
+	objects := make([]domain.HostOSConfigurationModules, 0, len(cfg.Channels))
+	for _, ch := range cfg.Channels {
+		l.Printf("Rendering the %s channel from %s", ch.Name, ch.File)
+		idx, err := index.Read(ctx, ch.File)
+		if err != nil {
+			return nil, err
+		}
+
+		idx.Metadata.Labels = maps.Clone(labels)
+		idx.Metadata.Annotations = maps.Clone(annotations)
+		objects = append(objects, idx)
+	}
+
+	if cfg.Output == "" {
+		return objects, nil
+	}
+
+	if err := writeFile(cfg.Output, func(w io.Writer) error { return Encode(ctx, w, objects) }); err != nil {
+		return nil, err
+	}
+	l.Printf("Manifests written to %s", cfg.Output)
+
+	if cfg.Kustomization {
+		name := filepath.Join(filepath.Dir(cfg.Output), KustomizationFileName)
+		if err := writeFile(name, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n  - %s\n", filepath.Base(cfg.Output))
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		l.Printf("Kustomization written to %s", name)
+	}
+
+	return objects, nil
+}
+
+// Encode serializes objects to w as a multi-document YAML stream.
+func Encode(ctx context.Context, w io.Writer, objects []domain.HostOSConfigurationModules) error {
+	for i, obj := range objects {
+		var b strings.Builder
+		if err := index.Encode(ctx, &b, obj); err != nil {
+			return fmt.Errorf("failed to serialize %s: %w", obj.Metadata.Name, err)
+		}
+
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to serialize data to the %s: %w", name, err)
+	}
+
+	return f.Close()
+}
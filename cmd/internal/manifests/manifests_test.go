@@ -0,0 +1,160 @@
+package manifests
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+const wantManifests = `apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfigurationModules
+metadata:
+  name: mcc-modules
+  labels:
+    app.kubernetes.io/managed-by: module-builder
+    team: mosk
+  annotations:
+    module-builder.mirantis.com/build-time: "2026-01-02T03:04:05Z"
+    module-builder.mirantis.com/git-commit: 0123456789abcdef
+    module-builder.mirantis.com/version: v1.2.3
+    owner: infra
+spec:
+  modules:
+    - name: ntp
+      version: 1.1.0
+      sha256sum: ntp-1.1.0
+      description: Module for NTP configuration
+---
+apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfigurationModules
+metadata:
+  name: dev-mcc-modules
+  labels:
+    app.kubernetes.io/managed-by: module-builder
+    team: mosk
+  annotations:
+    module-builder.mirantis.com/build-time: "2026-01-02T03:04:05Z"
+    module-builder.mirantis.com/git-commit: 0123456789abcdef
+    module-builder.mirantis.com/version: v1.2.3
+    owner: infra
+spec:
+  modules:
+    - name: ntp
+      version: 1.1.1-dev
+      sha256sum: ntp-1.1.1-dev
+      description: Module for NTP configuration
+`
+
+const wantKustomization = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+  - modules.yaml
+`
+
+// writeChannels writes the release and dev indexes of the ntp module.
+func writeChannels(t *testing.T, dir string) []config.Channel {
+	t.Helper()
+
+	channels := config.Default().Channels
+	for i, version := range []string{"1.1.0", "1.1.1-dev"} {
+		channels[i].File = filepath.Join(dir, channels[i].File)
+		m := domain.Module{
+			NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: version},
+			Sha256Sum:        "ntp-" + version,
+			Description:      "Module for NTP configuration",
+		}
+		if err := index.Write(context.Background(), channels[i].File, index.New(channels[i].APIVersion, channels[i].ObjectName, []domain.Module{m})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return channels
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "modules.yaml")
+
+	objects, err := Render(context.Background(), Config{
+		LogWriter:      io.Discard,
+		Channels:       writeChannels(t, dir),
+		Labels:         map[string]string{"team": "mosk"},
+		Annotations:    map[string]string{"owner": "infra"},
+		Output:         output,
+		Kustomization:  true,
+		BuilderVersion: "v1.2.3",
+		GitCommit:      "0123456789abcdef",
+		BuildTime:      time.Date(2026, 1, 2, 5, 4, 5, 0, time.FixedZone("EET", 2*60*60)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Metadata.Name != "mcc-modules" || objects[1].Metadata.Name != "dev-mcc-modules" {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+
+	for name, want := range map[string]string{
+		output: wantManifests,
+		filepath.Join(dir, KustomizationFileName): wantKustomization,
+	} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("unexpected %s:\n%s", filepath.Base(name), got)
+		}
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	dir := t.TempDir()
+
+	objects, err := Render(context.Background(), Config{
+		LogWriter: io.Discard,
+		Channels:  writeChannels(t, dir)[:1],
+		Labels:    map[string]string{ManagedByLabel: "ci"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+	if got := objects[0].Metadata.Labels[ManagedByLabel]; got != "ci" {
+		t.Errorf("expected the overridden label, got %s", got)
+	}
+	if len(objects[0].Metadata.Annotations) != 0 {
+		t.Errorf("expected no annotations, got %v", objects[0].Metadata.Annotations)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only indexes in %s, got %v", dir, entries)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Render(context.Background(), Config{LogWriter: io.Discard, Channels: writeChannels(t, dir), Kustomization: true})
+	if err == nil || !strings.Contains(err.Error(), "output file is required") {
+		t.Errorf("expected error emitting the kustomization without output, got %v", err)
+	}
+
+	channels := config.Default().Channels
+	channels[0].File = filepath.Join(dir, "missing.yaml")
+	if _, err := Render(context.Background(), Config{LogWriter: io.Discard, Channels: channels}); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Errorf("expected error reading the missing index, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package merge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"regexp"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/sort"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+type Config struct {
+	LogWriter  io.Writer // logger
+	Sources    []Source  // indexes to merge
+	Output     string    // merged index file
+	Name       string    // merged HostOSConfigurationModules object name
+	APIVersion string    // merged object apiVersion, kaas.mirantis.com/v1alpha1 if empty
+}
+
+// NamespaceSeparator joins the namespace and the module name. Module names
+// consist of lowercase letters, digits and underscores, hence the prefixed
+// name is unambiguous and stays a valid object and file name, unlike a slash.
+const NamespaceSeparator = "-"
+
+var namespaceRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Source is an index to merge, module names are prefixed
+// with the namespace and the separator if the namespace is set.
+type Source struct {
+	Namespace string
+	File      string
+}
+
+// Indexes merges modules from several indexes into a single sorted one.
+func Indexes(ctx context.Context, cfg Config) (domain.HostOSConfigurationModules, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	if cfg.Name == "" {
+		return domain.HostOSConfigurationModules{}, errors.New("name of the merged object is required")
+	}
+
+	type entry struct {
+		module domain.Module
+		source string
+	}
+
+	var (
+		merr    error
+		modules []domain.Module
+		seen    = map[domain.NameVersionTuple]entry{}
+	)
+	for _, src := range cfg.Sources {
+		if src.Namespace != "" && !namespaceRe.MatchString(src.Namespace) {
+			return domain.HostOSConfigurationModules{}, fmt.Errorf("invalid namespace %q of the %s, only lowercase letters, digits and underscores are allowed", src.Namespace, src.File)
+		}
+
+		l.Printf("Merging modules from the %s", src.File)
+		idx, err := index.Read(ctx, src.File)
+		if err != nil {
+			return domain.HostOSConfigurationModules{}, err
+		}
+
+		for _, m := range idx.Spec.Modules {
+			if _, err := semver.StrictNewVersion(m.Version); err != nil {
+				merr = errors.Join(merr, fmt.Errorf("%s: module %s has invalid semver version: %w", src.File, m, err))
+				continue
+			}
+
+			if src.Namespace != "" {
+				m.Name = src.Namespace + NamespaceSeparator + m.Name
+			}
+
+			prev, exists := seen[m.NameVersionTuple]
+			switch {
+			case !exists:
+				seen[m.NameVersionTuple] = entry{module: m, source: src.File}
+				modules = append(modules, m)
+			case prev.module.Sha256Sum == m.Sha256Sum:
+				l.Printf("Module %s from the %s is already merged from the %s", m, src.File, prev.source)
+			default:
+				merr = errors.Join(merr, fmt.Errorf("module %s collides: sha256sum %s in %s, %s in %s",
+					m, prev.module.Sha256Sum, prev.source, m.Sha256Sum, src.File))
+			}
+		}
+	}
+
+	if merr != nil {
+		return domain.HostOSConfigurationModules{}, merr
+	}
+
+	sort.Modules(modules)
+	merged := index.New(cfg.APIVersion, cfg.Name, modules)
+
+	if cfg.Output != "" {
+		absOutput, err := filepath.Abs(cfg.Output)
+		if err != nil {
+			return merged, fmt.Errorf("failed to determine abs path for the %s: %w", cfg.Output, err)
+		}
+
+		l.Printf("Writing %d modules to the %s", len(modules), absOutput)
+		if err := index.Write(ctx, absOutput, merged); err != nil {
+			return merged, fmt.Errorf("failed to write merged index: %w", err)
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,141 @@
+package merge
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+func module(name, version, sha string) domain.Module {
+	return domain.Module{NameVersionTuple: domain.NameVersionTuple{Name: name, Version: version}, Sha256Sum: sha}
+}
+
+// writeIndex writes the index file with the modules to the directory.
+func writeIndex(t *testing.T, dir, name string, modules ...domain.Module) string {
+	t.Helper()
+
+	file := filepath.Join(dir, name)
+	if err := index.Write(context.Background(), file, index.New("", "modules", modules)); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestIndexes(t *testing.T) {
+	dir := t.TempDir()
+	upstream := writeIndex(t, dir, "upstream.yaml", module("sysctl", "1.0.0", "aaa"), module("ntp", "1.0.0", "bbb"))
+	vendor := writeIndex(t, dir, "vendor.yaml", module("ntp", "1.0.0", "ccc"), module("ntp", "2.0.0-dev", "ddd"))
+	overlap := writeIndex(t, dir, "overlap.yaml", module("ntp", "1.0.0", "bbb"), module("auditd", "1.0.0", "eee"))
+
+	for name, tc := range map[string]struct {
+		sources []Source
+		want    []domain.Module
+	}{
+		"prefixed namespaces": {
+			sources: []Source{{File: upstream}, {Namespace: "acme", File: vendor}},
+			want: []domain.Module{
+				module("acme-ntp", "1.0.0", "ccc"),
+				module("acme-ntp", "2.0.0-dev", "ddd"),
+				module("ntp", "1.0.0", "bbb"),
+				module("sysctl", "1.0.0", "aaa"),
+			},
+		},
+		"same name in different namespaces": {
+			sources: []Source{{Namespace: "acme", File: upstream}, {Namespace: "vendor", File: vendor}},
+			want: []domain.Module{
+				module("acme-ntp", "1.0.0", "bbb"),
+				module("acme-sysctl", "1.0.0", "aaa"),
+				module("vendor-ntp", "1.0.0", "ccc"),
+				module("vendor-ntp", "2.0.0-dev", "ddd"),
+			},
+		},
+		"identical duplicate": {
+			sources: []Source{{File: upstream}, {File: overlap}},
+			want: []domain.Module{
+				module("auditd", "1.0.0", "eee"),
+				module("ntp", "1.0.0", "bbb"),
+				module("sysctl", "1.0.0", "aaa"),
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "index.yaml")
+			merged, err := Indexes(context.Background(), Config{LogWriter: io.Discard, Sources: tc.sources, Output: output, Name: "merged-modules"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if merged.Metadata.Name != "merged-modules" || merged.APIVersion != domain.HOCMAPIVersion {
+				t.Errorf("unexpected merged object %s %s", merged.APIVersion, merged.Metadata.Name)
+			}
+			if !reflect.DeepEqual(merged.Spec.Modules, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, merged.Spec.Modules)
+			}
+
+			written, err := index.Read(context.Background(), output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(written, merged) {
+				t.Errorf("expected written %+v, got %+v", merged, written)
+			}
+		})
+	}
+}
+
+func TestIndexesErrors(t *testing.T) {
+	dir := t.TempDir()
+	upstream := writeIndex(t, dir, "upstream.yaml", module("ntp", "1.0.0", "bbb"))
+	vendor := writeIndex(t, dir, "vendor.yaml", module("ntp", "1.0.0", "ccc"))
+	prefixed := writeIndex(t, dir, "prefixed.yaml", module("acme-ntp", "1.0.0", "ddd"))
+	invalid := writeIndex(t, dir, "invalid.yaml", module("ntp", "1.0", "eee"))
+
+	for name, tc := range map[string]struct {
+		cfg     Config
+		wantErr string
+	}{
+		"conflicting sha256sum": {
+			cfg:     Config{Sources: []Source{{File: upstream}, {File: vendor}}, Name: "merged-modules"},
+			wantErr: "module ntp-1.0.0 collides: sha256sum bbb in " + upstream + ", ccc in " + vendor,
+		},
+		"prefixed name collision": {
+			cfg:     Config{Sources: []Source{{Namespace: "acme", File: upstream}, {File: prefixed}}, Name: "merged-modules"},
+			wantErr: "module acme-ntp-1.0.0 collides: sha256sum bbb in " + upstream + ", ddd in " + prefixed,
+		},
+		"invalid namespace": {
+			cfg:     Config{Sources: []Source{{Namespace: "Acme/x", File: upstream}}, Name: "merged-modules"},
+			wantErr: `invalid namespace "Acme/x"`,
+		},
+		"invalid version": {
+			cfg:     Config{Sources: []Source{{File: invalid}}, Name: "merged-modules"},
+			wantErr: "module ntp-1.0 has invalid semver version",
+		},
+		"missing index": {
+			cfg:     Config{Sources: []Source{{File: filepath.Join(dir, "missing.yaml")}}, Name: "merged-modules"},
+			wantErr: "missing.yaml",
+		},
+		"missing name": {
+			cfg:     Config{Sources: []Source{{File: upstream}}},
+			wantErr: "name of the merged object is required",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.LogWriter = io.Discard
+			cfg.Output = filepath.Join(t.TempDir(), "index.yaml")
+
+			_, err := Indexes(context.Background(), cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+			if _, err := index.Read(context.Background(), cfg.Output); err == nil {
+				t.Error("merged index is written on error")
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrMismatch is returned if an archive differs from the index.
+var ErrMismatch = errors.New("sha256sum mismatch")
+
+// backoff is the delay before the first retry, doubled for every next one.
+var backoff = time.Second
+
+type Config struct {
+	LogWriter io.Writer    // logger
+	BaseURL   string       // repository URL, e.g. https://binary.mirantis.com/bm/bin/host-os-modules
+	Index     string       // index file name relative to the BaseURL
+	Dest      string       // where to put the index and archives
+	Parallel  int          // number of concurrent downloads, 1 if not positive
+	Retries   int          // number of retries of a failed download
+	Client    *http.Client // HTTP client, http.DefaultClient if nil
+}
+
+// Result holds modules of the mirrored index.
+type Result struct {
+	Downloaded []domain.Module `json:"downloaded"` // archives fetched from the repository
+	Present    []domain.Module `json:"present"`    // archives already present in the destination
+}
+
+type mirror struct {
+	logger  *log.Logger
+	client  *http.Client
+	baseURL string
+	dest    string
+	retries int
+}
+
+// Modules fetches the index and every archive not yet present in the destination,
+// verifying them against the index. The index is written to the destination
+// only if all its archives are mirrored.
+func Modules(cfg Config) (Result, error) {
+	m := &mirror{
+		logger:  log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile),
+		client:  cfg.Client,
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		dest:    cfg.Dest,
+		retries: cfg.Retries,
+	}
+	if m.client == nil {
+		m.client = http.DefaultClient
+	}
+	return m.run(cfg.Index, max(cfg.Parallel, 1))
+}
+
+func (m *mirror) run(indexName string, parallel int) (Result, error) {
+	res := Result{Downloaded: []domain.Module{}, Present: []domain.Module{}}
+
+	if err := checkName(indexName); err != nil {
+		return res, err
+	}
+
+	var indexData buffer
+	if err := m.fetch(indexName, &indexData); err != nil {
+		return res, err
+	}
+
+	var idx domain.HostOSConfigurationModules
+	if err := yaml.Unmarshal(indexData.Bytes(), &idx); err != nil {
+		return res, fmt.Errorf("failed to deserialize data from %s: %w", indexName, err)
+	}
+	m.logger.Printf("Mirroring %d modules of the %s index", len(idx.Spec.Modules), indexName)
+
+	if err := os.MkdirAll(m.dest, 0o755); err != nil {
+		return res, fmt.Errorf("failed to create %s: %w", m.dest, err)
+	}
+
+	var (
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, parallel)
+		downloaded = make([]bool, len(idx.Spec.Modules))
+		errs       = make([]error, len(idx.Spec.Modules))
+	)
+	for i, module := range idx.Spec.Modules {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, module domain.Module) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			downloaded[i], errs[i] = m.archive(module)
+		}(i, module)
+	}
+	wg.Wait()
+
+	var merr error
+	for i, module := range idx.Spec.Modules {
+		switch {
+		case errs[i] != nil:
+			merr = errors.Join(merr, fmt.Errorf("module %s: %w", module.NameVersionTuple, errs[i]))
+		case downloaded[i]:
+			res.Downloaded = append(res.Downloaded, module)
+		default:
+			res.Present = append(res.Present, module)
+		}
+	}
+	if merr != nil {
+		return res, merr
+	}
+
+	name := filepath.Join(m.dest, indexName)
+	if err := writeFile(name, indexData.Bytes()); err != nil {
+		return res, err
+	}
+	m.logger.Printf("Index written to %s", name)
+
+	return res, nil
+}
+
+// archive downloads the module archive unless the destination has it already.
+func (m *mirror) archive(module domain.Module) (bool, error) {
+	name := module.ArchiveName()
+	if err := checkName(name); err != nil {
+		return false, err
+	}
+
+	file := filepath.Join(m.dest, name)
+	if shasum, err := artifact.FileSha256(file); err == nil {
+		if shasum != module.Sha256Sum {
+			return false, fmt.Errorf("refusing to overwrite %s: %w, index %s, file %s", file, ErrMismatch, module.Sha256Sum, shasum)
+		}
+		m.logger.Printf("Archive %s is present", name)
+		return false, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(m.dest, "."+name+".*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := m.fetch(name, fileWriter{tmp}); err != nil {
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+
+	shasum, err := artifact.FileSha256(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	if shasum != module.Sha256Sum {
+		return false, fmt.Errorf("downloaded %s: %w, index %s, file %s", name, ErrMismatch, module.Sha256Sum, shasum)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return false, fmt.Errorf("failed to set permissions of %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return false, fmt.Errorf("failed to move %s: %w", file, err)
+	}
+
+	m.logger.Printf("Archive %s downloaded", name)
+	return true, nil
+}
+
+// resetWriter is a writer that can discard data written on a previous attempt.
+type resetWriter interface {
+	io.Writer
+	Reset() error
+}
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Reset() error {
+	b.Buffer.Reset()
+	return nil
+}
+
+type fileWriter struct {
+	*os.File
+}
+
+func (f fileWriter) Reset() error {
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", f.Name(), err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// fetch downloads the file from the repository to w, retrying on network
+// failures and server errors.
+func (m *mirror) fetch(name string, w resetWriter) error {
+	u := m.baseURL + "/" + url.PathEscape(name)
+
+	var err error
+	for attempt := 0; attempt <= m.retries; attempt++ {
+		if attempt > 0 {
+			delay := backoff << (attempt - 1)
+			m.logger.Printf("Retrying %s in %s: %v", u, delay, err)
+			time.Sleep(delay)
+
+			if err := w.Reset(); err != nil {
+				return err
+			}
+		}
+
+		var retry bool
+		retry, err = m.get(u, w)
+		if err == nil || !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// get downloads the URL to w and reports if a failure is worth retrying.
+func (m *mirror) get(u string, w io.Writer) (bool, error) {
+	resp, err := m.client.Get(u)
+	if err != nil {
+		return true, fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return true, fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+
+	return false, nil
+}
+
+// checkName rejects names escaping the destination directory.
+func checkName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("malformed file name %q", name)
+	}
+	return nil
+}
+
+// writeFile atomically replaces the file with data.
+func writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
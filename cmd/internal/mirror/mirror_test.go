@@ -0,0 +1,186 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var archives = map[string]string{
+	"ntp-1.0.0.tgz":    "ntp archive",
+	"ntp-1.1.0.tgz":    "ntp archive v1.1",
+	"sysctl-1.0.0.tgz": "sysctl archive",
+}
+
+func sha(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func testIndex() string {
+	return fmt.Sprintf(`apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfigurationModules
+metadata:
+  name: mcc-modules
+spec:
+  modules:
+    - name: ntp
+      version: 1.0.0
+      sha256sum: %s
+    - name: ntp
+      version: 1.1.0
+      sha256sum: %s
+    - name: sysctl
+      version: 1.0.0
+      sha256sum: %s
+`, sha(archives["ntp-1.0.0.tgz"]), sha(archives["ntp-1.1.0.tgz"]), sha(archives["sysctl-1.0.0.tgz"]))
+}
+
+// newServer returns a stand-in repository failing the first request of every file.
+func newServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]bool{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/repo/")
+		data, found := files[name]
+		if !ok || !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		first := !seen[name]
+		seen[name] = true
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = io.WriteString(w, data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testConfig(srv *httptest.Server, dest string) Config {
+	return Config{
+		LogWriter: io.Discard,
+		BaseURL:   srv.URL + "/repo/",
+		Index:     "index.yaml",
+		Dest:      dest,
+		Parallel:  2,
+		Retries:   2,
+		Client:    srv.Client(),
+	}
+}
+
+// noBackoff disables delays between retries for the duration of the test.
+func noBackoff(t *testing.T) {
+	old := backoff
+	backoff = 0
+	t.Cleanup(func() { backoff = old })
+}
+
+func TestModules(t *testing.T) {
+	noBackoff(t)
+
+	files := map[string]string{"index.yaml": testIndex()}
+	for name, data := range archives {
+		files[name] = data
+	}
+	srv := newServer(t, files)
+	dest := t.TempDir()
+
+	res, err := Modules(testConfig(srv, dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Downloaded) != 3 || len(res.Present) != 0 {
+		t.Fatalf("expected 3 downloaded modules, got %+v", res)
+	}
+	for name, data := range files {
+		bb, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bb) != data {
+			t.Errorf("unexpected %s contents %q", name, bb)
+		}
+	}
+
+	res, err = Modules(testConfig(srv, dest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Downloaded) != 0 || len(res.Present) != 3 {
+		t.Fatalf("expected 3 present modules, got %+v", res)
+	}
+}
+
+func TestModulesMismatch(t *testing.T) {
+	noBackoff(t)
+
+	t.Run("existing", func(t *testing.T) {
+		files := map[string]string{"index.yaml": testIndex()}
+		for name, data := range archives {
+			files[name] = data
+		}
+		srv := newServer(t, files)
+		dest := t.TempDir()
+
+		existing := filepath.Join(dest, "ntp-1.0.0.tgz")
+		if err := os.WriteFile(existing, []byte("local ntp archive"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Modules(testConfig(srv, dest))
+		if !errors.Is(err, ErrMismatch) {
+			t.Fatalf("expected mismatch error, got %v", err)
+		}
+		if bb, _ := os.ReadFile(existing); string(bb) != "local ntp archive" {
+			t.Errorf("existing archive is overwritten with %q", bb)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "index.yaml")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("index is written despite failures: %v", err)
+		}
+	})
+
+	t.Run("downloaded", func(t *testing.T) {
+		files := map[string]string{"index.yaml": testIndex()}
+		for name, data := range archives {
+			files[name] = data
+		}
+		files["sysctl-1.0.0.tgz"] = "tampered sysctl archive"
+		srv := newServer(t, files)
+		dest := t.TempDir()
+
+		_, err := Modules(testConfig(srv, dest))
+		if !errors.Is(err, ErrMismatch) {
+			t.Fatalf("expected mismatch error, got %v", err)
+		}
+
+		entries, err := os.ReadDir(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Name() != "ntp-1.0.0.tgz" && e.Name() != "ntp-1.1.0.tgz" {
+				t.Errorf("unexpected file %s in the destination", e.Name())
+			}
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package module
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"io"
@@ -8,68 +11,85 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-
-	"module-builder/internal/domain"
-)
-
-type PromoteType int
-
-const (
-	PromoteNone PromoteType = iota
-	PromoteMinor
-	PromoteMajor
+	"slices"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+	"github.com/Mirantis/host-os-modules/cmd/internal/provenance"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sign"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/archive"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/version"
+
+	"gopkg.in/yaml.v3"
 )
 
-func (t *PromoteType) Set(value string) error {
-	switch value {
-	case "none", "":
-		*t = PromoteNone
-	case "minor":
-		*t = PromoteMinor
-	case "major":
-		*t = PromoteMajor
-	default:
-		return fmt.Errorf("only one of [<empty>, none, minor, major], given %s", value)
-	}
-	return nil
+type Config struct {
+	LogWriter io.Writer         // logger
+	Dir       string            // git working tree relative paths are resolved in, the current directory if empty
+	Output    string            // where to put archives
+	Dirs      []string          // module path (either abs or rel)
+	Promote   version.Promotion // type of promotion (dev, minor, major)
+
+	// Channels to update with built modules, the upstream
+	// index.yaml and index-dev.yaml if empty.
+	Channels []config.Channel
+
+	// SigningKey signs archives and written indexes with detached
+	// signatures put to the output directory and next to index files
+	// respectively, disabled if nil.
+	SigningKey ed25519.PrivateKey
+
+	// Provenance describes the builder to emit provenance attestations
+	// of archives to the output directory, disabled if nil.
+	Provenance *provenance.Builder
+
+	// ReplaceReason allows to replace already released modules
+	// with different sha256sum, disabled if empty.
+	ReplaceReason string
 }
 
-func (i PromoteType) String() string {
-	switch i {
-	case PromoteNone:
-		return "None"
-	case PromoteMinor:
-		return "Minor"
-	case PromoteMajor:
-		return "Major"
-	default:
-		return ""
+type (
+	// Result describes modules built by Build.
+	Result struct {
+		Modules    []ModuleResult `json:"modules"`
+		Indexes    []string       `json:"indexes"`              // index files changed by the build
+		Signatures []string       `json:"signatures,omitempty"` // detached signatures of index files
 	}
-}
 
-type Config struct {
-	LogWriter io.Writer   // logger
-	Output    string      // where to put archives
-	Dirs      []string    // module path (either abs or rel)
-	Promote   PromoteType // type of promotion (dev, minor, major)
-}
+	// ModuleResult is a single module built by Build.
+	ModuleResult struct {
+		Name       string `json:"name"`
+		OldVersion string `json:"oldVersion"`
+		NewVersion string `json:"newVersion"`
+		Archive    string `json:"archive"`
+		Sha256Sum  string `json:"sha256sum"`
+		Size       int64  `json:"size"`
+		Changed    bool   `json:"changed"` // module has uncommitted changes
+		Signature  string `json:"signature,omitempty"`
+		Provenance string `json:"provenance,omitempty"`
+	}
+)
 
-// Build archive and index for modules.
-func Build(cfg Config) error {
+// Build archive and index for modules. On error, the result
+// contains modules processed before the failure.
+func Build(ctx context.Context, cfg Config) (res Result, err error) {
 	defer func() {
-		if err := recover(); err != nil {
-			log.Printf("build recover: %v", err)
+		if r := recover(); r != nil {
+			log.Printf("build recover: %v", r)
+			err = fmt.Errorf("build panicked: %v", r)
 		}
 	}()
 
 	builder, err := newBuilder(cfg)
 	if err != nil {
 		_ = builder.Close() // sanity
-		return err
+		return Result{}, err
 	}
 
 	defer builder.Close()
-	return builder.Run()
+	return builder.Run(ctx)
 }
 
 type singleData struct {
@@ -79,26 +99,43 @@ type singleData struct {
 	dirBase string // module dir base
 
 	hasChanges bool
+	dirty      bool // sources differ from the commit before the version bump
 }
 
 type builder struct {
 	logger *log.Logger
+	dir    string // git working tree
 
-	archiveOutputDir    string
-	devIndexAbsPath     string
-	releaseIndexAbsPath string
+	archiveOutputDir string
+	channels         []config.Channel
 
 	modulesInfo []singleData
 
-	promote PromoteType
+	promote       version.Promotion
+	replaceReason string
+	now           func() time.Time // clock of replacements
+	signingKey    ed25519.PrivateKey
+
+	provenance *provenance.Builder
+	source     provenance.Source
 }
 
 func newBuilder(cfg Config) (*builder, error) {
 	b := &builder{
 		modulesInfo:      make([]singleData, len(cfg.Dirs)),
 		promote:          cfg.Promote,
+		replaceReason:    cfg.ReplaceReason,
+		now:              time.Now,
+		signingKey:       cfg.SigningKey,
+		provenance:       cfg.Provenance,
 		logger:           log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile),
+		dir:              cfg.Dir,
 		archiveOutputDir: cfg.Output,
+		channels:         slices.Clone(cfg.Channels),
+	}
+
+	if len(b.channels) == 0 {
+		b.channels = config.Default().Channels
 	}
 
 	// determine abs paths
@@ -106,6 +143,21 @@ func newBuilder(cfg Config) (*builder, error) {
 		return nil, err
 	}
 
+	if b.provenance != nil {
+		source, err := provenance.GitSource(b.dir)
+		if err != nil {
+			return nil, err
+		}
+		b.source = source
+
+		// the state is determined before metadata.yaml is rewritten by the bump
+		for i, m := range b.modulesInfo {
+			if b.modulesInfo[i].dirty, err = provenance.Dirty(b.dir, m.dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// determine if changes persist
 	changes, err := b.getChanges(cfg.Dirs)
 	if err != nil {
@@ -120,56 +172,179 @@ func newBuilder(cfg Config) (*builder, error) {
 	return b, nil
 }
 
-func (b *builder) Run() error {
+func (b *builder) Run(ctx context.Context) (Result, error) {
+	res := Result{
+		Modules: make([]ModuleResult, 0, len(b.modulesInfo)),
+		Indexes: []string{},
+	}
 	modules := make([]domain.Module, len(b.modulesInfo))
 
 	var merr error
 	for i, m := range b.modulesInfo {
-		tuple, err := b.bumpModuleMetaVersion(m)
+		meta, oldVersion, err := b.bumpModuleMetaVersion(m)
 		if err != nil {
 			b.logger.Printf("ERROR: could not bump module %s version: %v", m.dirBase, err)
 			merr = errors.Join(merr, err)
 			continue
 		}
 
-		modules[i].NameVersionTuple = tuple
+		modules[i] = domain.Module{
+			NameVersionTuple:       meta.NameVersionTuple,
+			Description:            meta.Description,
+			DocURL:                 meta.DocURL,
+			SupportedDistributions: meta.SupportedDistributions,
+			Deprecates:             meta.Deprecates,
+		}
+		res.Modules = append(res.Modules, ModuleResult{
+			Name:       meta.Name,
+			OldVersion: oldVersion,
+			NewVersion: meta.Version,
+			Changed:    m.hasChanges,
+		})
 	}
 
 	if merr != nil {
 		b.logger.Printf("Error bumping modules versions: %v", merr)
-		return fmt.Errorf("modules versions bump failed: %v", merr)
+		return res, fmt.Errorf("modules versions bump failed: %w", merr)
 	}
 
 	for i, module := range modules {
-		shasum, err := makeArchive(module.Name, module.Version, b.archiveOutputDir)
+		b.logger.Printf("Starting to build the archive of the module %s", module.NameVersionTuple)
+		built, err := archive.Build(ctx, b.modulesInfo[i].dir, module.NameVersionTuple, b.archiveOutputDir)
 		if err != nil {
 			b.logger.Printf("ERROR: could make tgz with module %s: %v", module.NameVersionTuple, err)
 			merr = errors.Join(merr, err)
 			continue
 		}
 
-		modules[i].Sha256Sum = shasum
+		modules[i].Sha256Sum = built.Sha256Sum
+		modules[i].Size = built.Size
+
+		res.Modules[i].Archive = built.Path
+		res.Modules[i].Sha256Sum = built.Sha256Sum
+		res.Modules[i].Size = built.Size
+
+		if err := b.sign(built.Path); err != nil {
+			b.logger.Printf("ERROR: could not sign tgz with module %s: %v", module.NameVersionTuple, err)
+			merr = errors.Join(merr, err)
+		} else if b.signingKey != nil {
+			res.Modules[i].Signature = b.signatureName(built.Path)
+		}
+
+		if err := b.attest(modules[i], b.modulesInfo[i], res.Modules[i].OldVersion); err != nil {
+			b.logger.Printf("ERROR: could not attest tgz with module %s: %v", module.NameVersionTuple, err)
+			merr = errors.Join(merr, err)
+		} else if b.provenance != nil {
+			res.Modules[i].Provenance = built.Path + provenance.Suffix
+		}
 	}
 
 	if merr != nil {
 		b.logger.Printf("Error making tgz archives: %v", merr)
-		return fmt.Errorf("archives baking failed: %v", merr)
+		return res, fmt.Errorf("archives baking failed: %w", merr)
 	}
 
-	if b.promote == PromoteNone {
-		b.logger.Printf("Updating dev index with %d modules", len(modules))
-		if err := b.updateDevIndex(modules); err != nil {
+	before := b.readIndexes()
+	if b.promote == version.PromoteNone {
+		b.logger.Printf("Updating dev indexes with %d modules", len(modules))
+		if err := b.updateDevIndexes(ctx, modules); err != nil {
 			b.logger.Printf("Error updating dev index: %v", err)
-			return fmt.Errorf("dev index update failed: %v", err)
+			return res, fmt.Errorf("dev index update failed: %w", err)
 		}
 	} else {
-		if err := b.promoteUpdateIndexes(modules); err != nil {
+		if err := b.promoteUpdateIndexes(ctx, modules); err != nil {
 			b.logger.Printf("Error updating index: %v", err)
-			return fmt.Errorf("release index update failed: %v", err)
+			return res, fmt.Errorf("release index update failed: %w", err)
 		}
 	}
+	after := b.readIndexes()
 
-	return nil
+	for _, ch := range b.channels {
+		if !bytes.Equal(before[ch.File], after[ch.File]) {
+			res.Indexes = append(res.Indexes, ch.File)
+		}
+	}
+
+	signatures, err := b.signIndexes(after)
+	res.Signatures = signatures
+	if err != nil {
+		b.logger.Printf("Error signing indexes: %v", err)
+		return res, fmt.Errorf("indexes signing failed: %w", err)
+	}
+
+	return res, nil
+}
+
+// signIndexes puts detached signatures next to written index files.
+func (b *builder) signIndexes(written map[string][]byte) ([]string, error) {
+	if b.signingKey == nil {
+		return nil, nil
+	}
+
+	var (
+		signatures []string
+		merr       error
+	)
+	for _, ch := range b.channels {
+		if _, ok := written[ch.File]; !ok {
+			continue // channel is not populated yet
+		}
+
+		sigName := ch.File + sign.Suffix
+		b.logger.Printf("Signing %s to %s", ch.File, sigName)
+		if err := sign.File(b.signingKey, ch.File, sigName); err != nil {
+			merr = errors.Join(merr, err)
+			continue
+		}
+		signatures = append(signatures, sigName)
+	}
+
+	return signatures, merr
+}
+
+// readIndexes returns contents of channel index files, missing ones are skipped.
+func (b *builder) readIndexes() map[string][]byte {
+	contents := make(map[string][]byte, len(b.channels))
+	for _, ch := range b.channels {
+		if bb, err := os.ReadFile(ch.File); err == nil {
+			contents[ch.File] = bb
+		}
+	}
+	return contents
+}
+
+// sign puts the detached signature of the file to the output directory.
+func (b *builder) sign(name string) error {
+	if b.signingKey == nil {
+		return nil
+	}
+
+	sigName := b.signatureName(name)
+	b.logger.Printf("Signing %s to %s", name, sigName)
+	return sign.File(b.signingKey, name, sigName)
+}
+
+// signatureName returns the name of the detached signature of the file.
+func (b *builder) signatureName(name string) string {
+	return filepath.Join(b.archiveOutputDir, filepath.Base(name)+sign.Suffix)
+}
+
+// attest puts the provenance of the module archive to the output directory.
+// The version bump of the sources is recorded explicitly, so it does not
+// make the sources of the committed version dirty.
+func (b *builder) attest(m domain.Module, info singleData, sourceVersion string) error {
+	if b.provenance == nil {
+		return nil
+	}
+
+	params := provenance.InternalParameters{Dirty: info.dirty}
+	if sourceVersion != m.Version {
+		params.SourceVersion = sourceVersion
+	}
+
+	name := filepath.Join(b.archiveOutputDir, m.ArchiveName()+provenance.Suffix)
+	b.logger.Printf("Writing provenance of the module %s to %s", m.NameVersionTuple, name)
+	return provenance.Write(name, provenance.New(*b.provenance, b.source, m, params))
 }
 
 func (b *builder) Close() error {
@@ -188,35 +363,24 @@ func (b *builder) Close() error {
 }
 
 func (b *builder) collectAbsPaths(dirs []string) error {
-	devIndexAbsPath, err := filepath.Abs(domain.DevIndexFileName)
-	if err != nil {
-		return fmt.Errorf("failed to determine abs path for the %s: %w", domain.DevIndexFileName, err)
-	}
-	b.devIndexAbsPath = devIndexAbsPath
-
-	releaseIndexAbsPath, err := filepath.Abs(domain.ReleaseIndexFileName)
-	if err != nil {
-		return fmt.Errorf("failed to determine abs path for the %s: %w", domain.ReleaseIndexFileName, err)
-	}
-	b.releaseIndexAbsPath = releaseIndexAbsPath
-
-	if !filepath.IsAbs(b.archiveOutputDir) {
-		archOutAbs, err := filepath.Abs(b.archiveOutputDir)
+	for i, ch := range b.channels {
+		absFile, err := b.abs(ch.File)
 		if err != nil {
-			return fmt.Errorf("failed to determine abs path for the %s: %w", b.archiveOutputDir, err)
+			return err
 		}
+		b.channels[i].File = absFile
+	}
 
-		b.archiveOutputDir = archOutAbs
+	archOutAbs, err := b.abs(b.archiveOutputDir)
+	if err != nil {
+		return err
 	}
+	b.archiveOutputDir = archOutAbs
 
 	for idx, dir := range dirs {
-		absDir := dir
-		if !filepath.IsAbs(dir) {
-			var err error
-			absDir, err = filepath.Abs(dir)
-			if err != nil {
-				return fmt.Errorf("failed to determine abs path for the %s: %w", dir, err)
-			}
+		absDir, err := b.abs(dir)
+		if err != nil {
+			return err
 		}
 
 		b.modulesInfo[idx] = singleData{
@@ -228,8 +392,53 @@ func (b *builder) collectAbsPaths(dirs []string) error {
 	return nil
 }
 
+// abs returns the absolute path, relative ones are resolved in the working tree.
+func (b *builder) abs(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+
+	absName, err := filepath.Abs(filepath.Join(b.dir, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to determine abs path for the %s: %w", name, err)
+	}
+	return absName, nil
+}
+
 func (b *builder) getChanges(dirs []string) ([]byte, error) {
+	output, isChangeDetected, err := gitDiff(b.dir, dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// fail fast on incorrect cfg
+	if isChangeDetected && b.promote != version.PromoteNone {
+		return nil, fmt.Errorf("there are changes in modules, but promotion flag is provided")
+	}
+
+	return output, nil
+}
+
+// Changes returns names of modules having uncommitted changes
+// in the working tree, the current directory if empty.
+func Changes(worktree string, dirs []string) (map[string]bool, error) {
+	output, _, err := gitDiff(worktree, dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+	for _, w := range parseModuleNames(output) {
+		changed[string(w)] = true
+	}
+	return changed, nil
+}
+
+// gitDiff returns NUL separated names of files changed
+// in dirs of the working tree, the current one if empty.
+func gitDiff(worktree string, dirs []string) ([]byte, bool, error) {
 	diffFlags := []string{
+		"diff",
 		"--exit-code",   // target the exit code
 		"-z",            // simplier counting
 		"--name-only",   // determine a change in a particular module
@@ -238,25 +447,17 @@ func (b *builder) getChanges(dirs []string) ([]byte, error) {
 
 	isChangeDetected := false
 
-	cmd := exec.Command("git", "diff")
-	cmd.Args = append(append(cmd.Args, diffFlags...), dirs...)
-
-	output, err := cmd.Output()
+	output, err := git.Run(worktree, append(diffFlags, dirs...)...)
 	if err != nil {
 		exitErr := new(exec.ExitError)
 		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
 			isChangeDetected = true
 		} else {
-			return nil, fmt.Errorf("failed execution of the '%s' command: %w", cmd.String(), err)
+			return nil, false, err
 		}
 	}
 
-	// fail fast on incorrect cfg
-	if isChangeDetected && b.promote != PromoteNone {
-		return nil, fmt.Errorf("there are changes in modules, but promotion flag is provided")
-	}
-
-	return output, nil
+	return []byte(output), isChangeDetected, nil
 }
 
 func (b *builder) openMetadataFiles(data []byte) error {
@@ -271,11 +472,25 @@ func (b *builder) openMetadataFiles(data []byte) error {
 		_, requiredChange := changedModules[m.dirBase]
 
 		flags := os.O_RDONLY
-		if requiredChange || b.promote != PromoteNone {
+		if requiredChange || b.promote != version.PromoteNone {
 			flags = os.O_RDWR | os.O_CREATE
 		}
 
 		fileName := filepath.Join(m.dir, metadataFileName)
+
+		// scaffolded modules get the first dev version on the next build
+		isNew, err := isNewModule(fileName)
+		if err != nil {
+			return err
+		}
+		if isNew && b.promote != version.PromoteNone {
+			return fmt.Errorf("module %s is not built yet, build it before the promotion", m.dirBase)
+		}
+		if isNew {
+			requiredChange = true
+			flags = os.O_RDWR
+		}
+
 		f, err := os.OpenFile(fileName, flags, 0o644)
 		if err != nil {
 			return fmt.Errorf("failed to open file: %w", err)
@@ -289,3 +504,18 @@ func (b *builder) openMetadataFiles(data []byte) error {
 
 	return nil
 }
+
+// isNewModule reports whether the module metadata has the initial version.
+func isNewModule(metadataFile string) (bool, error) {
+	bb, err := os.ReadFile(metadataFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", metadataFile, err)
+	}
+
+	var meta domain.NameVersionTuple
+	if err := yaml.Unmarshal(bb, &meta); err != nil {
+		return false, fmt.Errorf("failed to deserialize yaml %s: %w", metadataFile, err)
+	}
+
+	return meta.Version == domain.InitialVersion, nil
+}
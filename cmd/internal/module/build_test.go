@@ -0,0 +1,132 @@
+package module
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/git/gittest"
+	"github.com/Mirantis/host-os-modules/cmd/internal/provenance"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sign"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/version"
+)
+
+const testMetadata = `name: ntp
+description: 'Module for NTP configuration'
+version: 1.0.1-dev
+valuesJsonSchema: schema.json
+docURL: https://example.com/ntp/README.md
+playbook: main.yaml
+`
+
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+
+	return gittest.New(t, map[string]string{
+		"ntp/metadata.yaml": testMetadata,
+		"ntp/main.yaml":     "---\n",
+		"ntp/schema.json":   "{}\n",
+	})
+}
+
+func TestBuildProvenance(t *testing.T) {
+	for name, tc := range map[string]struct {
+		files   map[string]string
+		promote version.Promotion
+
+		wantVersion       string
+		wantDirty         bool
+		wantSourceVersion string
+	}{
+		"promotion": {
+			promote:           version.PromoteMinor,
+			wantVersion:       "1.1.0",
+			wantSourceVersion: "1.0.1-dev",
+		},
+		"uncommitted change": {
+			files:             map[string]string{"ntp/main.yaml": "- hosts: all\n"},
+			wantVersion:       "1.0.2-dev",
+			wantDirty:         true,
+			wantSourceVersion: "1.0.1-dev",
+		},
+		"committed version": {
+			wantVersion: "1.0.1-dev",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := newTestRepo(t)
+			gittest.Write(t, repo, tc.files)
+			output := t.TempDir()
+
+			res, err := Build(context.Background(), Config{
+				LogWriter:  io.Discard,
+				Dir:        repo,
+				Output:     output,
+				Dirs:       []string{"ntp"},
+				Promote:    tc.promote,
+				Provenance: &provenance.Builder{ID: "module-builder", Version: "v1.0.0"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Modules) != 1 || res.Modules[0].NewVersion != tc.wantVersion {
+				t.Fatalf("expected ntp %s to be built, got %+v", tc.wantVersion, res.Modules)
+			}
+
+			st, err := provenance.Read(res.Modules[0].Provenance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := provenance.Verify(st, res.Modules[0].Archive); err != nil {
+				t.Fatal(err)
+			}
+
+			params := st.Predicate.BuildDefinition.InternalParameters
+			if params.Dirty != tc.wantDirty || params.SourceVersion != tc.wantSourceVersion {
+				t.Errorf("expected dirty %t and source version %q, got %+v", tc.wantDirty, tc.wantSourceVersion, params)
+			}
+			if got := st.Predicate.BuildDefinition.ResolvedDependencies[0].Digest["gitCommit"]; got != gittest.Run(t, repo, "rev-parse", "HEAD") {
+				t.Errorf("unexpected commit %s", got)
+			}
+			if got := filepath.Dir(res.Modules[0].Archive); got != output {
+				t.Errorf("expected archive in %s, got %s", output, got)
+			}
+		})
+	}
+}
+
+func TestBuildSignsIndexes(t *testing.T) {
+	repo := newTestRepo(t)
+	output := t.TempDir()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Build(context.Background(), Config{
+		LogWriter:  io.Discard,
+		Dir:        repo,
+		Output:     output,
+		Dirs:       []string{"ntp"},
+		SigningKey: priv,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{filepath.Join(repo, domain.DevIndexFileName+sign.Suffix)}; !slices.Equal(res.Signatures, want) {
+		t.Fatalf("expected signatures %v, got %v", want, res.Signatures)
+	}
+	if err := sign.Verify(pub, filepath.Join(repo, domain.DevIndexFileName), res.Signatures[0]); err != nil {
+		t.Error(err)
+	}
+	if err := sign.Verify(pub, res.Modules[0].Archive, res.Modules[0].Signature); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,40 +1,69 @@
 package module
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"slices"
-	"strings"
+	"time"
 
-	"module-builder/internal/domain"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
 
 	"gopkg.in/yaml.v3"
 )
 
-func (b *builder) updateDevIndex(newModules []domain.Module) error {
-	indexFile, err := os.OpenFile(b.devIndexAbsPath, os.O_RDWR|os.O_CREATE, 0o644)
+// ErrReleased is returned on an attempt to replace a released module
+// with a different archive without a replace reason.
+var ErrReleased = errors.New("released module differs from the built one")
+
+// updateDevIndexes rewrites indexes of dev channels with the new modules.
+func (b *builder) updateDevIndexes(ctx context.Context, newModules []domain.Module) error {
+	for _, ch := range b.channels {
+		if ch.Stage != config.StageDev {
+			continue
+		}
+
+		b.logger.Printf("Updating %s channel index %s", ch.Name, ch.File)
+		if err := b.updateDevIndex(ctx, ch, newModules); err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *builder) updateDevIndex(ctx context.Context, ch config.Channel, newModules []domain.Module) error {
+	filteredModules, err := ch.Filter(newModules)
 	if err != nil {
-		return fmt.Errorf("failed to read %s file: %w", b.devIndexAbsPath, err)
+		return err
 	}
-	defer indexFile.Close()
 
-	filteredModules := filterDevVersions(newModules)
+	indexFile, err := os.OpenFile(ch.File, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %w", ch.File, err)
+	}
+	defer indexFile.Close()
 
 	// create if did not exist
 	if stat, _ := indexFile.Stat(); stat.Size() == 0 {
-		if err := createIndex(indexFile, domain.DevHOCMObjName, filteredModules); err != nil {
+		if err := createIndex(ctx, indexFile, ch, filteredModules); err != nil {
 			return fmt.Errorf("failed to create index: %w", err)
 		}
 		return nil
 	}
 
-	var index domain.HostOSConfigurationModules
-	if err := yaml.NewDecoder(indexFile).Decode(&index); err != nil {
-		return fmt.Errorf("failed to deserialize %s: %w", b.devIndexAbsPath, err)
+	var idx domain.HostOSConfigurationModules
+	if err := yaml.NewDecoder(indexFile).Decode(&idx); err != nil {
+		return fmt.Errorf("failed to deserialize %s: %w", ch.File, err)
 	}
 
-	index.Spec.Modules = filteredModules
+	idx.APIVersion = ch.APIVersion
+	idx.Metadata.Name = ch.ObjectName
+	idx.Spec.Modules = filteredModules
 
 	if err := indexFile.Truncate(0); err != nil {
 		return fmt.Errorf("failed to truncate %s: %w", indexFile.Name(), err)
@@ -43,41 +72,14 @@ func (b *builder) updateDevIndex(newModules []domain.Module) error {
 		return fmt.Errorf("failed to seek %s: %w", indexFile.Name(), err)
 	}
 
-	enc := yaml.NewEncoder(indexFile)
-	enc.SetIndent(2)
-	if err := enc.Encode(&index); err != nil {
-		return fmt.Errorf("failed to serialize data to the %s: %w", b.devIndexAbsPath, err)
+	if err := index.Encode(ctx, indexFile, idx); err != nil {
+		return fmt.Errorf("failed to serialize data to the %s: %w", ch.File, err)
 	}
 
-	return enc.Close()
-}
-
-func filterDevVersions(modules []domain.Module) []domain.Module {
-	devModules := []domain.Module{}
-	for _, newModule := range modules {
-		if strings.HasSuffix(newModule.Version, developmentTag) {
-			devModules = append(devModules, newModule)
-		}
-	}
-	return slices.Clip(devModules)
+	return nil
 }
 
-func createIndex(indexFile *os.File, indexName string, newModules []domain.Module) error {
-	index := domain.HostOSConfigurationModules{
-		APIVersion: "kaas.mirantis.com/v1alpha1",
-		Kind:       "HostOSConfigurationModules",
-		Metadata: struct {
-			Name string "yaml:\"name\""
-		}{
-			Name: indexName,
-		},
-		Spec: struct {
-			Modules []domain.Module "yaml:\"modules\""
-		}{
-			Modules: newModules,
-		},
-	}
-
+func createIndex(ctx context.Context, indexFile *os.File, ch config.Channel, newModules []domain.Module) error {
 	if err := indexFile.Truncate(0); err != nil {
 		return fmt.Errorf("failed to truncate %s: %w", indexFile.Name(), err)
 	}
@@ -85,7 +87,7 @@ func createIndex(indexFile *os.File, indexName string, newModules []domain.Modul
 		return fmt.Errorf("failed to seek %s: %w", indexFile.Name(), err)
 	}
 
-	if err := yaml.NewEncoder(indexFile).Encode(&index); err != nil {
+	if err := index.Encode(ctx, indexFile, index.New(ch.APIVersion, ch.ObjectName, newModules)); err != nil {
 		return fmt.Errorf("failed to serialize index to %s: %w", indexFile.Name(), err)
 	}
 
@@ -107,55 +109,121 @@ func dropPromotedVersions(devIndexModules []domain.Module, newModules []domain.M
 	return result
 }
 
-func (b *builder) promoteUpdateIndexes(newModules []domain.Module) error {
-	releaseIndexFile, err := os.OpenFile(b.releaseIndexAbsPath, os.O_RDWR|os.O_CREATE, 0o644)
-	if err != nil {
-		return fmt.Errorf("failed to read %s file: %w", b.releaseIndexAbsPath, err)
+// mergeReleasedModules appends new modules to the released ones. Released
+// artifacts are immutable, hence an already released module with the same
+// sha256sum is skipped, while a different sha256sum is an error unless
+// a replace reason has been provided. The replaced entry is overwritten
+// with the new module recording the reason and the time of the replacement.
+func (b *builder) mergeReleasedModules(released, newModules []domain.Module) ([]domain.Module, error) {
+	result := slices.Clone(released)
+	positions := make(map[domain.NameVersionTuple]int, len(result))
+	for i, m := range result {
+		positions[m.NameVersionTuple] = i
 	}
-	defer releaseIndexFile.Close()
 
-	newProdModule := newModules
-	if stat, _ := releaseIndexFile.Stat(); stat.Size() != 0 {
-		var releaseIndex domain.HostOSConfigurationModules
+	var merr error
+	for _, newModule := range newModules {
+		i, exists := positions[newModule.NameVersionTuple]
+		switch {
+		case !exists:
+			positions[newModule.NameVersionTuple] = len(result)
+			result = append(result, newModule)
+		case result[i].IsYanked():
+			b.logger.Printf("WARNING: module %s is yanked (%s), skipping", newModule, result[i].YankReason)
+		case result[i].IsEqual(newModule):
+			b.logger.Printf("Module %s is already released, skipping", newModule)
+		case b.replaceReason != "":
+			b.logger.Printf("WARNING: replacing released module %s sha256sum %s -> %s, reason: %s",
+				newModule, result[i].Sha256Sum, newModule.Sha256Sum, b.replaceReason)
+			replacedAt := b.now().UTC().Truncate(time.Second)
+			newModule.ReplaceReason = b.replaceReason
+			newModule.ReplacedAt = &replacedAt
+			result[i] = newModule
+		default:
+			merr = errors.Join(merr, fmt.Errorf("module %s is already released with sha256sum %s, got %s: %w",
+				newModule, result[i].Sha256Sum, newModule.Sha256Sum, ErrReleased))
+		}
+	}
 
-		if err := yaml.NewDecoder(releaseIndexFile).Decode(&releaseIndex); err != nil {
-			return fmt.Errorf("failed to deserialize %s: %w", b.releaseIndexAbsPath, err)
+	return result, merr
+}
+
+// promoteUpdateIndexes adds the new modules to indexes of release channels
+// and drops their previous versions from indexes of dev channels.
+func (b *builder) promoteUpdateIndexes(ctx context.Context, newModules []domain.Module) error {
+	for _, ch := range b.channels {
+		if ch.Stage != config.StageRelease {
+			continue
 		}
-		newProdModule = append(releaseIndex.Spec.Modules, newModules...)
 
-		if err := releaseIndexFile.Truncate(0); err != nil {
-			return fmt.Errorf("failed to truncate %s: %w", releaseIndexFile.Name(), err)
+		b.logger.Printf("Updating %s channel index %s", ch.Name, ch.File)
+		filteredModules, err := ch.Filter(newModules)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
 		}
-		if _, err := releaseIndexFile.Seek(0, io.SeekStart); err != nil {
-			return fmt.Errorf("failed to seek %s: %w", releaseIndexFile.Name(), err)
+		if err := b.updateReleaseIndex(ctx, ch, filteredModules); err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
 		}
 	}
-	if err := createIndex(releaseIndexFile, domain.ReleaseHOCMObjName, newProdModule); err != nil {
+
+	for _, ch := range b.channels {
+		if ch.Stage != config.StageDev {
+			continue
+		}
+
+		b.logger.Printf("Dropping promoted modules from %s channel index %s", ch.Name, ch.File)
+		if err := dropPromotedIndex(ctx, ch, newModules); err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *builder) updateReleaseIndex(ctx context.Context, ch config.Channel, newModules []domain.Module) error {
+	releaseIndexFile, err := os.OpenFile(ch.File, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %w", ch.File, err)
+	}
+	defer releaseIndexFile.Close()
+
+	var releaseIndex domain.HostOSConfigurationModules
+	stat, _ := releaseIndexFile.Stat()
+	if stat.Size() != 0 {
+		if err := yaml.NewDecoder(releaseIndexFile).Decode(&releaseIndex); err != nil {
+			return fmt.Errorf("failed to deserialize %s: %w", ch.File, err)
+		}
+	}
+
+	newProdModule, err := b.mergeReleasedModules(releaseIndex.Spec.Modules, newModules)
+	if err != nil {
+		return fmt.Errorf("failed to merge modules into %s: %w", ch.File, err)
+	}
+
+	if err := createIndex(ctx, releaseIndexFile, ch, newProdModule); err != nil {
 		return fmt.Errorf("failed to create index: %w", err)
 	}
 
+	return nil
+}
+
+func dropPromotedIndex(ctx context.Context, ch config.Channel, newModules []domain.Module) error {
 	var devIndex domain.HostOSConfigurationModules
-	devIndexFile, err := os.OpenFile(b.devIndexAbsPath, os.O_RDWR|os.O_CREATE, 0o644)
+	devIndexFile, err := os.OpenFile(ch.File, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
-		return fmt.Errorf("failed to read %s file: %w", b.devIndexAbsPath, err)
+		return fmt.Errorf("failed to read %s file: %w", ch.File, err)
 	}
 	defer devIndexFile.Close()
 
-	if err := yaml.NewDecoder(devIndexFile).Decode(&devIndex); err != nil {
-		return fmt.Errorf("failed to deserialize %s: %w", b.devIndexAbsPath, err)
+	if stat, _ := devIndexFile.Stat(); stat.Size() != 0 {
+		if err := yaml.NewDecoder(devIndexFile).Decode(&devIndex); err != nil {
+			return fmt.Errorf("failed to deserialize %s: %w", ch.File, err)
+		}
 	}
 
 	updatedDevModules := dropPromotedVersions(devIndex.Spec.Modules, newModules)
 
-	if stat, _ := devIndexFile.Stat(); stat.Size() != 0 {
-		if err := devIndexFile.Truncate(0); err != nil {
-			return fmt.Errorf("failed to truncate %s: %w", devIndexFile.Name(), err)
-		}
-		if _, err := devIndexFile.Seek(0, io.SeekStart); err != nil {
-			return fmt.Errorf("failed to seek %s: %w", devIndexFile.Name(), err)
-		}
-	}
-	if err := createIndex(devIndexFile, domain.DevHOCMObjName, updatedDevModules); err != nil {
+	if err := createIndex(ctx, devIndexFile, ch, updatedDevModules); err != nil {
 		return fmt.Errorf("failed to create index: %w", err)
 	}
 	return nil
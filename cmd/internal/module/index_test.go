@@ -0,0 +1,88 @@
+package module
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+func TestMergeReleasedModules(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ntp := domain.NameVersionTuple{Name: "ntp", Version: "1.1.0"}
+	released := []domain.Module{
+		{NameVersionTuple: domain.NameVersionTuple{Name: "auditd", Version: "1.0.0"}, Sha256Sum: "aaa"},
+		{NameVersionTuple: ntp, Sha256Sum: "bbb", Size: 10},
+	}
+
+	for name, tc := range map[string]struct {
+		reason  string
+		module  domain.Module
+		want    domain.Module
+		wantErr error
+	}{
+		"same archive": {
+			module: domain.Module{NameVersionTuple: ntp, Sha256Sum: "bbb", Size: 10},
+			want:   domain.Module{NameVersionTuple: ntp, Sha256Sum: "bbb", Size: 10},
+		},
+		"different archive": {
+			module:  domain.Module{NameVersionTuple: ntp, Sha256Sum: "ccc", Size: 20},
+			want:    domain.Module{NameVersionTuple: ntp, Sha256Sum: "bbb", Size: 10},
+			wantErr: ErrReleased,
+		},
+		"forced replace": {
+			reason: "CVE-2026-0001",
+			module: domain.Module{NameVersionTuple: ntp, Sha256Sum: "ccc", Size: 20, Description: "NTP"},
+			want: domain.Module{
+				NameVersionTuple: ntp,
+				Sha256Sum:        "ccc",
+				Size:             20,
+				Description:      "NTP",
+				ReplaceReason:    "CVE-2026-0001",
+				ReplacedAt:       &now,
+			},
+		},
+		"forced replace of the same archive": {
+			reason: "CVE-2026-0001",
+			module: domain.Module{NameVersionTuple: ntp, Sha256Sum: "bbb", Size: 10},
+			want:   domain.Module{NameVersionTuple: ntp, Sha256Sum: "bbb", Size: 10},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := &builder{
+				logger:        log.New(io.Discard, "", 0),
+				replaceReason: tc.reason,
+				now:           func() time.Time { return now.Add(500 * time.Millisecond) },
+			}
+
+			merged, err := b.mergeReleasedModules(released, []domain.Module{tc.module})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("error %v, want %v", err, tc.wantErr)
+			}
+
+			if len(merged) != len(released) {
+				t.Fatalf("got %d modules, want %d", len(merged), len(released))
+			}
+			if !merged[0].IsEqual(released[0]) {
+				t.Errorf("unrelated module is changed: %+v", merged[0])
+			}
+
+			got := merged[1]
+			if got.Sha256Sum != tc.want.Sha256Sum || got.Size != tc.want.Size || got.Description != tc.want.Description ||
+				got.ReplaceReason != tc.want.ReplaceReason {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			if (got.ReplacedAt == nil) != (tc.want.ReplacedAt == nil) ||
+				got.ReplacedAt != nil && !got.ReplacedAt.Equal(*tc.want.ReplacedAt) {
+				t.Errorf("replaced at %v, want %v", got.ReplacedAt, tc.want.ReplacedAt)
+			}
+
+			if released[1].Sha256Sum != "bbb" {
+				t.Error("released modules are modified in place")
+			}
+		})
+	}
+}
@@ -6,68 +6,37 @@ import (
 	"io"
 	"os"
 
-	"module-builder/internal/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/version"
 
-	"github.com/Masterminds/semver/v3"
 	"gopkg.in/yaml.v3"
 )
 
-const developmentTag = "dev"
-
 // bumpModuleMetaVersion parses metadata.yaml of a single module,
 // and if required, bumps its version and modifies the metadata.yaml back.
-func (b *builder) bumpModuleMetaVersion(data singleData) (meta domain.NameVersionTuple, _ error) {
+// The version before the bump is returned along with the metadata.
+func (b *builder) bumpModuleMetaVersion(data singleData) (meta domain.Metadata, oldVersion string, _ error) {
 	if err := yaml.NewDecoder(data.meta).Decode(&meta); err != nil {
-		return meta, fmt.Errorf("failed to deserialize yaml %s: %w", data.meta.Name(), err)
-	}
-
-	moduleVersion, err := semver.NewVersion(meta.Version)
-	if err != nil {
-		b.logger.Printf("Malformed semver of the module %s: %v", meta, err)
-		return meta, fmt.Errorf("failed to parse module version %s: %w", meta.Version, err)
+		return meta, "", fmt.Errorf("failed to deserialize yaml %s: %w", data.meta.Name(), err)
 	}
 
-	var (
-		mustModifyMeta       bool
-		currentHasPrerelease = moduleVersion.Prerelease() != ""
-	)
+	oldVersion = meta.Version
 
-	if b.promote != PromoteNone && currentHasPrerelease {
-		// if previous version is dev version, do promotion,
-		// otherwise the current version is already promoted for release, so nothing to do.
-		mustModifyMeta = true
-
-		if b.promote == PromoteMajor {
-			*moduleVersion = moduleVersion.IncMajor()
-		} else {
-			*moduleVersion = moduleVersion.IncMinor()
-		}
-	}
-
-	if data.hasChanges { // promote is None
-		mustModifyMeta = true
-
-		*moduleVersion = moduleVersion.IncPatch()
-		if currentHasPrerelease {
-			*moduleVersion = moduleVersion.IncPatch() // incrementing on pre-version just drops it without increasing
-		}
-
-		*moduleVersion, err = moduleVersion.SetPrerelease(developmentTag)
-		if err != nil {
-			return meta, fmt.Errorf("failed to set prerelease version for module %s: %w", meta, err)
-		}
+	newVersion, err := version.Bump(meta.Version, data.hasChanges, b.promote)
+	if err != nil {
+		b.logger.Printf("Could not bump version of the module %s: %v", meta.NameVersionTuple, err)
+		return meta, oldVersion, err
 	}
 
-	if mustModifyMeta {
-		newVersion := moduleVersion.String()
-		if err := b.modifyMetadataVersion(data.meta, meta.Version, newVersion); err != nil {
-			return meta, fmt.Errorf("modifying metadata.yaml failed: %w", err)
+	if newVersion != oldVersion {
+		if err := b.modifyMetadataVersion(data.meta, oldVersion, newVersion); err != nil {
+			return meta, oldVersion, fmt.Errorf("modifying metadata.yaml failed: %w", err)
 		}
 
 		meta.Version = newVersion
 	}
 
-	return meta, nil
+	return meta, oldVersion, nil
 }
 
 func (b *builder) modifyMetadataVersion(file *os.File, oldVersion, newVersion string) error {
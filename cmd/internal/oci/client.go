@@ -0,0 +1,342 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// reference is a repository in a registry with an optional tag or digest.
+type reference struct {
+	registry   string
+	repository string
+	reference  string
+}
+
+// parseReference parses <registry>/<repository>[:<tag>|@<digest>].
+func parseReference(s string) (reference, error) {
+	var ref reference
+
+	registry, repository, ok := strings.Cut(s, "/")
+	if !ok || registry == "" || repository == "" {
+		return ref, fmt.Errorf("malformed reference %q, expected <registry>/<repository>[:<tag>]", s)
+	}
+	ref.registry = registry
+
+	if repo, digest, ok := strings.Cut(repository, "@"); ok {
+		repository, ref.reference = repo, digest
+	} else if i := strings.LastIndex(repository, ":"); i >= 0 {
+		repository, ref.reference = repository[:i], repository[i+1:]
+	}
+
+	if repository == "" || repository != strings.ToLower(repository) {
+		return ref, fmt.Errorf("malformed reference %q, repository must be lowercase", s)
+	}
+	ref.repository = repository
+
+	return ref, nil
+}
+
+func (r reference) String() string {
+	s := r.registry + "/" + r.repository
+	switch {
+	case strings.HasPrefix(r.reference, "sha256:"):
+		s += "@" + r.reference
+	case r.reference != "":
+		s += ":" + r.reference
+	}
+	return s
+}
+
+// client implements the subset of the OCI distribution API to push and pull artifacts.
+type client struct {
+	http      *http.Client
+	plainHTTP bool
+	auth      string // user:password
+
+	mu     sync.Mutex
+	tokens map[string]string // scope to bearer token
+}
+
+func newClient(c *http.Client, plainHTTP bool, auth string) *client {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return &client{http: c, plainHTTP: plainHTTP, auth: auth, tokens: map[string]string{}}
+}
+
+func (c *client) url(registry, path string) string {
+	scheme := "https"
+	if c.plainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + registry + "/v2/" + path
+}
+
+// do sends the request, answering the authentication challenge if needed.
+// The body must be re-readable, i.e. nil or *bytes.Reader.
+func (c *client) do(req *http.Request, repository string, push bool) (*http.Response, error) {
+	scope := "repository:" + repository + ":pull"
+	if push {
+		scope += ",push"
+	}
+
+	c.mu.Lock()
+	token := c.tokens[scope]
+	c.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", req.Method, req.URL, err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch {
+	case strings.EqualFold(scheme, "Basic") && c.auth != "":
+		user, password, _ := strings.Cut(c.auth, ":")
+		req.SetBasicAuth(user, password)
+	case strings.EqualFold(scheme, "Bearer"):
+		token, err := c.token(parseChallenge(params), scope)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.tokens[scope] = token
+		c.mu.Unlock()
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return nil, fmt.Errorf("failed to %s %s: unauthorized", req.Method, req.URL)
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	resp, err = c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+// token fetches the bearer token for the scope from the challenge realm.
+func (c *client) token(challenge map[string]string, scope string) (string, error) {
+	realm := challenge["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("malformed bearer challenge without realm")
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("malformed bearer realm %q: %w", realm, err)
+	}
+	q := u.Query()
+	if service := challenge["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if user, password, ok := strings.Cut(c.auth, ":"); ok {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch token from %s: %w", realm, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch token from %s: %s", realm, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to deserialize token from %s: %w", realm, err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+
+	return body.Token, nil
+}
+
+// parseChallenge parses comma separated key="value" challenge parameters.
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	for s != "" {
+		var kv string
+		kv, s = splitParam(s)
+		k, v, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		params[strings.ToLower(k)] = strings.Trim(v, `"`)
+	}
+	return params
+}
+
+// splitParam cuts the first parameter respecting commas in quoted values.
+func splitParam(s string) (string, string) {
+	quoted := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// blobExists reports whether the repository has the blob.
+func (c *client) blobExists(ref reference, digest string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, c.url(ref.registry, ref.repository+"/blobs/"+digest), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req, ref.repository, true)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check blob %s in %s: %s", digest, ref.repository, resp.Status)
+	}
+}
+
+// pushBlob uploads the blob unless the repository has it already.
+func (c *client) pushBlob(ref reference, digest string, data []byte) error {
+	exists, err := c.blobExists(ref, digest)
+	if err != nil || exists {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url(ref.registry, ref.repository+"/blobs/uploads/"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req, ref.repository, true)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to start upload to %s: %s", ref.repository, resp.Status)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("malformed upload location: %w", err)
+	}
+	q := location.Query()
+	q.Set("digest", digest)
+	location.RawQuery = q.Encode()
+
+	req, err = http.NewRequest(http.MethodPut, location.String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err = c.do(req, ref.repository, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload blob %s to %s: %s: %s", digest, ref.repository, resp.Status, readSnippet(resp.Body))
+	}
+
+	return nil
+}
+
+// pushManifest puts the manifest with the tag or digest reference.
+func (c *client) pushManifest(ref reference, mediaType string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.url(ref.registry, ref.repository+"/manifests/"+ref.reference), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", mediaType)
+
+	resp, err := c.do(req, ref.repository, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to push manifest %s: %s: %s", ref, resp.Status, readSnippet(resp.Body))
+	}
+
+	return nil
+}
+
+// fetch returns the manifest or blob, nil if it does not exist.
+func (c *client) fetch(ref reference, kind, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url(ref.registry, ref.repository+"/"+kind+"/"+ref.reference), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := c.do(req, ref.repository, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to fetch %s: %s", ref, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+
+	return data, nil
+}
+
+func readSnippet(r io.Reader) string {
+	bb, _ := io.ReadAll(io.LimitReader(r, 512))
+	return strings.TrimSpace(string(bb))
+}
@@ -0,0 +1,459 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// AuthEnv is the environment variable with user:password registry credentials.
+	AuthEnv = "MODULE_BUILDER_REGISTRY_AUTH"
+
+	// ArtifactType is the artifact type of module manifests.
+	ArtifactType = "application/vnd.mirantis.host-os-module.v1"
+	// LayerMediaType is the media type of the module archive layer.
+	LayerMediaType = "application/vnd.mirantis.host-os-module.layer.v1.tar+gzip"
+	// IndexArtifactType is the artifact type of the image index mirroring index.yaml.
+	IndexArtifactType = "application/vnd.mirantis.host-os-modules.index.v1"
+
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeEmpty    = "application/vnd.oci.empty.v1+json"
+
+	annotationTitle       = "org.opencontainers.image.title"
+	annotationVersion     = "org.opencontainers.image.version"
+	annotationDescription = "org.opencontainers.image.description"
+
+	annotationName       = "com.mirantis.host-os-module.name"
+	annotationModVersion = "com.mirantis.host-os-module.version"
+	annotationSha256Sum  = "com.mirantis.host-os-module.sha256sum"
+
+	annotationObjectName = "com.mirantis.host-os-modules.object-name"
+	annotationAPIVersion = "com.mirantis.host-os-modules.api-version"
+	annotationIndexFile  = "com.mirantis.host-os-modules.file"
+)
+
+// ErrReleased is returned on an attempt to overwrite a released module version.
+var ErrReleased = errors.New("released module differs from the pushed one")
+
+// emptyConfig is the empty JSON config blob of artifacts.
+var emptyConfig = []byte("{}")
+
+type (
+	descriptor struct {
+		MediaType    string            `json:"mediaType"`
+		ArtifactType string            `json:"artifactType,omitempty"`
+		Digest       string            `json:"digest"`
+		Size         int64             `json:"size"`
+		Annotations  map[string]string `json:"annotations,omitempty"`
+	}
+
+	manifest struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		ArtifactType  string            `json:"artifactType"`
+		Config        descriptor        `json:"config"`
+		Layers        []descriptor      `json:"layers"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+	}
+
+	imageIndex struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		ArtifactType  string            `json:"artifactType"`
+		Manifests     []descriptor      `json:"manifests"`
+		Annotations   map[string]string `json:"annotations,omitempty"`
+	}
+)
+
+type Config struct {
+	LogWriter  io.Writer    // logger
+	Repository string       // <registry>/<repository>, modules are pushed to <repository>/<name>
+	Client     *http.Client // HTTP client, http.DefaultClient if nil
+	PlainHTTP  bool         // use HTTP instead of HTTPS
+	Auth       string       // user:password registry credentials, anonymous if empty
+}
+
+type PushConfig struct {
+	Config
+	Channel config.Channel // channel with modules to push
+	Output  string         // where archives are stored
+}
+
+type PullConfig struct {
+	Config
+	Tag  string // image index tag, the channel object name
+	Dest string // where to put the index and archives
+}
+
+// Push pushes every module of the channel index as an artifact tagged with its version
+// to <repository>/<name> and the image index mirroring the channel index to
+// <repository>:<object name>. Modules are pushed by digest to <repository> as well,
+// so the image index refers to manifests of its own repository.
+func Push(ctx context.Context, cfg PushConfig) error {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	base, err := parseReference(cfg.Repository)
+	if err != nil {
+		return err
+	}
+	if base.reference != "" {
+		return fmt.Errorf("repository %s must not have a tag", cfg.Repository)
+	}
+	c := newClient(cfg.Client, cfg.PlainHTTP, cfg.Auth)
+
+	idx, err := index.Read(ctx, cfg.Channel.File)
+	if err != nil {
+		return err
+	}
+
+	if err := c.pushBlob(base, digestOf(emptyConfig), emptyConfig); err != nil {
+		return err
+	}
+
+	descriptors := make([]descriptor, 0, len(idx.Spec.Modules))
+	for _, m := range idx.Spec.Modules {
+		desc, err := pushModule(l, c, base, cfg.Output, m)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", m.NameVersionTuple, err)
+		}
+		descriptors = append(descriptors, desc)
+	}
+
+	imgIdx := imageIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeIndex,
+		ArtifactType:  IndexArtifactType,
+		Manifests:     descriptors,
+		Annotations: map[string]string{
+			annotationObjectName: idx.Metadata.Name,
+			annotationAPIVersion: idx.APIVersion,
+			annotationIndexFile:  filepath.Base(cfg.Channel.File),
+		},
+	}
+	data, err := json.Marshal(imgIdx)
+	if err != nil {
+		return fmt.Errorf("failed to serialize image index: %w", err)
+	}
+
+	ref := base
+	ref.reference = idx.Metadata.Name
+	if err := c.pushManifest(ref, mediaTypeIndex, data); err != nil {
+		return err
+	}
+	l.Printf("Pushed image index of %d modules to %s", len(descriptors), ref)
+
+	return nil
+}
+
+// pushModule pushes the module artifact and returns its manifest descriptor.
+func pushModule(l *log.Logger, c *client, base reference, output string, m domain.Module) (descriptor, error) {
+	var desc descriptor
+
+	v, err := semver.StrictNewVersion(m.Version)
+	if err != nil {
+		return desc, fmt.Errorf("malformed version: %w", err)
+	}
+
+	moduleRef := base
+	moduleRef.repository += "/" + m.Name
+	moduleRef.reference = Tag(m.Version)
+
+	layerDigest := "sha256:" + m.Sha256Sum
+	data, err := os.ReadFile(filepath.Join(output, m.ArchiveName()))
+	if errors.Is(err, os.ErrNotExist) {
+		data = nil // must be pushed already
+	} else if err != nil {
+		return desc, fmt.Errorf("failed to read %s: %w", m.ArchiveName(), err)
+	} else if digestOf(data) != layerDigest {
+		return desc, fmt.Errorf("archive %s does not match the index sha256sum %s", m.ArchiveName(), m.Sha256Sum)
+	}
+
+	pushedMf, err := fetchManifest(c, moduleRef)
+	if err != nil {
+		return desc, err
+	}
+	var pushed string
+	if pushedMf != nil {
+		pushed = pushedMf.Layers[0].Digest
+	}
+	switch {
+	case pushed != "" && pushed != layerDigest && v.Prerelease() == "":
+		return desc, fmt.Errorf("refusing to overwrite %s: %w, pushed %s, local %s", moduleRef, ErrReleased, pushed, layerDigest)
+	case data == nil && pushed != layerDigest:
+		return desc, fmt.Errorf("archive %s is neither built in the output directory nor pushed to %s", m.ArchiveName(), moduleRef)
+	}
+
+	// the description of the archive metadata.yaml, the index entry has it only if enriched
+	if data != nil {
+		if m.Description, err = archiveDescription(data); err != nil {
+			return desc, fmt.Errorf("archive %s: %w", m.ArchiveName(), err)
+		}
+	} else {
+		m.Description = pushedMf.Annotations[annotationDescription]
+	}
+
+	mf := manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		ArtifactType:  ArtifactType,
+		Config: descriptor{
+			MediaType: mediaTypeEmpty,
+			Digest:    digestOf(emptyConfig),
+			Size:      int64(len(emptyConfig)),
+		},
+		Layers: []descriptor{{
+			MediaType:   LayerMediaType,
+			Digest:      layerDigest,
+			Size:        int64(len(data)),
+			Annotations: map[string]string{annotationTitle: m.ArchiveName()},
+		}},
+		Annotations: moduleAnnotations(m),
+	}
+
+	if data == nil {
+		// the layer size is only known from the pushed manifest
+		mf.Layers[0].Size = pushedMf.Layers[0].Size
+	}
+
+	mfData, err := json.Marshal(mf)
+	if err != nil {
+		return desc, fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	desc = descriptor{
+		MediaType:    mediaTypeManifest,
+		ArtifactType: ArtifactType,
+		Digest:       digestOf(mfData),
+		Size:         int64(len(mfData)),
+		Annotations:  moduleAnnotations(m),
+	}
+
+	// the image index requires manifests in its own repository
+	indexRef := base
+	indexRef.reference = desc.Digest
+	for _, ref := range []reference{moduleRef, indexRef} {
+		if err := c.pushBlob(ref, mf.Config.Digest, emptyConfig); err != nil {
+			return desc, err
+		}
+		if data != nil {
+			if err := c.pushBlob(ref, layerDigest, data); err != nil {
+				return desc, err
+			}
+		} else if exists, err := c.blobExists(ref, layerDigest); err != nil {
+			return desc, err
+		} else if !exists {
+			return desc, fmt.Errorf("archive %s is not built in the output directory to push to %s", m.ArchiveName(), ref)
+		}
+		if err := c.pushManifest(ref, mediaTypeManifest, mfData); err != nil {
+			return desc, err
+		}
+	}
+
+	l.Printf("Pushed module %s to %s", m.NameVersionTuple, moduleRef)
+	return desc, nil
+}
+
+// fetchManifest returns the module manifest, nil if it does not exist.
+func fetchManifest(c *client, ref reference) (*manifest, error) {
+	data, err := c.fetch(ref, "manifests", mediaTypeManifest)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var mf manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("failed to deserialize manifest %s: %w", ref, err)
+	}
+	if mf.ArtifactType != ArtifactType || len(mf.Layers) != 1 || mf.Layers[0].MediaType != LayerMediaType {
+		return nil, fmt.Errorf("manifest %s is not a host OS module", ref)
+	}
+
+	return &mf, nil
+}
+
+// Pull fetches the image index and every module archive it refers to,
+// verifying their digests, and writes the index file reconstructed from it.
+func Pull(ctx context.Context, cfg PullConfig) (domain.HostOSConfigurationModules, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	var idx domain.HostOSConfigurationModules
+
+	ref, err := parseReference(cfg.Repository)
+	if err != nil {
+		return idx, err
+	}
+	if ref.reference == "" {
+		ref.reference = cfg.Tag
+	}
+	c := newClient(cfg.Client, cfg.PlainHTTP, cfg.Auth)
+
+	data, err := c.fetch(ref, "manifests", mediaTypeIndex)
+	if err != nil {
+		return idx, err
+	}
+	if data == nil {
+		return idx, fmt.Errorf("image index %s is not found", ref)
+	}
+
+	var imgIdx imageIndex
+	if err := json.Unmarshal(data, &imgIdx); err != nil {
+		return idx, fmt.Errorf("failed to deserialize image index %s: %w", ref, err)
+	}
+	if imgIdx.ArtifactType != IndexArtifactType {
+		return idx, fmt.Errorf("image index %s is not a host OS modules index", ref)
+	}
+
+	indexFile := filepath.Base(imgIdx.Annotations[annotationIndexFile])
+	if indexFile == "." || indexFile == "/" || strings.HasPrefix(indexFile, ".") {
+		indexFile = "index.yaml"
+	}
+
+	if err := os.MkdirAll(cfg.Dest, 0o755); err != nil {
+		return idx, fmt.Errorf("failed to create %s: %w", cfg.Dest, err)
+	}
+
+	modules := make([]domain.Module, 0, len(imgIdx.Manifests))
+	for _, desc := range imgIdx.Manifests {
+		m, err := pullModule(c, ref, desc, cfg.Dest)
+		if err != nil {
+			return idx, err
+		}
+		l.Printf("Pulled module %s", m.NameVersionTuple)
+		modules = append(modules, m)
+	}
+
+	idx = index.New(imgIdx.Annotations[annotationAPIVersion], imgIdx.Annotations[annotationObjectName], modules)
+	name := filepath.Join(cfg.Dest, indexFile)
+	if err := index.Write(ctx, name, idx); err != nil {
+		return idx, err
+	}
+	l.Printf("Index written to %s", name)
+
+	return idx, nil
+}
+
+// pullModule fetches the module archive of the manifest to the destination.
+func pullModule(c *client, base reference, desc descriptor, dest string) (domain.Module, error) {
+	var m domain.Module
+
+	ref := base
+	ref.reference = desc.Digest
+	data, err := c.fetch(ref, "manifests", mediaTypeManifest)
+	if err != nil {
+		return m, err
+	}
+	if data == nil || digestOf(data) != desc.Digest {
+		return m, fmt.Errorf("manifest %s is missing or does not match its digest", ref)
+	}
+
+	var mf manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return m, fmt.Errorf("failed to deserialize manifest %s: %w", ref, err)
+	}
+	if mf.ArtifactType != ArtifactType || len(mf.Layers) != 1 || mf.Layers[0].MediaType != LayerMediaType {
+		return m, fmt.Errorf("manifest %s is not a host OS module", ref)
+	}
+
+	m.Name = mf.Annotations[annotationName]
+	m.Version = mf.Annotations[annotationModVersion]
+	m.Sha256Sum = mf.Annotations[annotationSha256Sum]
+	m.Description = mf.Annotations[annotationDescription]
+	if m.Name == "" || m.Name != filepath.Base(m.Name) || strings.HasPrefix(m.Name, ".") {
+		return m, fmt.Errorf("manifest %s has malformed module name %q", ref, m.Name)
+	}
+	if _, err := semver.StrictNewVersion(m.Version); err != nil {
+		return m, fmt.Errorf("manifest %s has malformed module version %q: %w", ref, m.Version, err)
+	}
+	if "sha256:"+m.Sha256Sum != mf.Layers[0].Digest {
+		return m, fmt.Errorf("manifest %s layer %s does not match the sha256sum %s", ref, mf.Layers[0].Digest, m.Sha256Sum)
+	}
+
+	ref.reference = mf.Layers[0].Digest
+	archive, err := c.fetch(ref, "blobs", "")
+	if err != nil {
+		return m, err
+	}
+	if archive == nil || digestOf(archive) != mf.Layers[0].Digest {
+		return m, fmt.Errorf("archive of the module %s is missing or does not match its sha256sum", m.NameVersionTuple)
+	}
+
+	name := filepath.Join(dest, m.ArchiveName())
+	if err := os.WriteFile(name, archive, 0o644); err != nil {
+		return m, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return m, nil
+}
+
+// Tag returns the tag of the module version, + is not allowed in tags.
+func Tag(version string) string {
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+func moduleAnnotations(m domain.Module) map[string]string {
+	a := map[string]string{
+		annotationTitle:      m.Name,
+		annotationVersion:    m.Version,
+		annotationName:       m.Name,
+		annotationModVersion: m.Version,
+		annotationSha256Sum:  m.Sha256Sum,
+	}
+	if m.Description != "" {
+		a[annotationDescription] = m.Description
+	}
+	return a
+}
+
+// archiveDescription returns the description of the module metadata.yaml in the archive.
+func archiveDescription(data []byte) (string, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to read gzip: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("metadata.yaml is missing")
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read tar: %w", err)
+		}
+		if header.Name != "metadata.yaml" {
+			continue
+		}
+
+		var meta domain.Metadata
+		if err := yaml.NewDecoder(tr).Decode(&meta); err != nil {
+			return "", fmt.Errorf("failed to deserialize metadata.yaml: %w", err)
+		}
+		return meta.Description, nil
+	}
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
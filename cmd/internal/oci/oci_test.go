@@ -0,0 +1,297 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+// registry is an in-process OCI distribution stand-in with token authentication.
+type registry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte // repository@digest to blob
+	manifests map[string][]byte // repository@digest to manifest
+	tags      map[string]string // repository:tag to digest
+	uploads   int
+}
+
+func newRegistry() *registry {
+	return &registry{blobs: map[string][]byte{}, manifests: map[string][]byte{}, tags: map[string]string{}}
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if u, p, ok := req.BasicAuth(); !ok || u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, req.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo, id, _ := strings.Cut(path, "/blobs/uploads/")
+		if req.Method == http.MethodPost {
+			r.uploads++
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", repo, r.uploads))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		if id == "" || digestOf(data) != req.URL.Query().Get("digest") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[repo+"@"+digestOf(data)] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		data, ok := r.blobs[path[:i]+"@"+path[i+len("/blobs/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		repo, ref := path[:i], path[i+len("/manifests/"):]
+		if req.Method == http.MethodPut {
+			data, _ := io.ReadAll(req.Body)
+			if err := r.checkReferences(repo, data); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			digest := digestOf(data)
+			r.manifests[repo+"@"+digest] = data
+			if !strings.HasPrefix(ref, "sha256:") {
+				r.tags[repo+":"+ref] = digest
+			}
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if d, ok := r.tags[repo+":"+ref]; ok {
+			ref = d
+		}
+		data, ok := r.manifests[repo+"@"+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// checkReferences ensures blobs and manifests referenced by the manifest are in the repository.
+func (r *registry) checkReferences(repo string, data []byte) error {
+	var m struct {
+		Config    *descriptor
+		Layers    []descriptor
+		Manifests []descriptor
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	blobs := m.Layers
+	if m.Config != nil {
+		blobs = append(blobs, *m.Config)
+	}
+	for _, d := range blobs {
+		if _, ok := r.blobs[repo+"@"+d.Digest]; !ok {
+			return fmt.Errorf("blob %s is unknown", d.Digest)
+		}
+	}
+	for _, d := range m.Manifests {
+		if _, ok := r.manifests[repo+"@"+d.Digest]; !ok {
+			return fmt.Errorf("manifest %s is unknown", d.Digest)
+		}
+	}
+	return nil
+}
+
+func sha(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// moduleArchive returns a module archive with the playbook and metadata.yaml describing the module.
+func moduleArchive(t *testing.T, name, playbook string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for file, data := range map[string]string{
+		"metadata.yaml": fmt.Sprintf("name: %s\ndescription: '%s module'\nplaybook: main.yaml\n", name, name),
+		"main.yaml":     playbook,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: file, Mode: 0o644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// writeChannel writes archives and the index referencing them, not enriched with descriptions.
+func writeChannel(t *testing.T, dir string, archives map[string]string) config.Channel {
+	t.Helper()
+
+	var b strings.Builder
+	b.WriteString("apiVersion: kaas.mirantis.com/v1alpha1\nkind: HostOSConfigurationModules\nmetadata:\n  name: mcc-modules\nspec:\n  modules:\n")
+	for _, nv := range []string{"ntp@1.0.0", "ntp@1.1.0", "sysctl@1.2.0-dev"} {
+		name, version, _ := strings.Cut(nv, "@")
+		data, ok := archives[nv]
+		if !ok {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+"-"+version+".tgz"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "    - name: %s\n      version: %s\n      sha256sum: %s\n", name, version, sha(data))
+	}
+
+	ch := config.Channel{Name: "release", File: filepath.Join(dir, "index.yaml"), ObjectName: "mcc-modules", Stage: config.StageRelease}
+	if err := os.WriteFile(ch.File, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestPushPull(t *testing.T) {
+	reg := newRegistry()
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	cfg := Config{
+		LogWriter:  io.Discard,
+		Repository: strings.TrimPrefix(srv.URL, "http://") + "/host-os-modules",
+		Client:     srv.Client(),
+		PlainHTTP:  true,
+		Auth:       "user:secret",
+	}
+
+	output := t.TempDir()
+	archives := map[string]string{
+		"ntp@1.0.0":        moduleArchive(t, "ntp", "# ntp 1.0.0\n"),
+		"ntp@1.1.0":        moduleArchive(t, "ntp", "# ntp 1.1.0\n"),
+		"sysctl@1.2.0-dev": moduleArchive(t, "sysctl", "# sysctl 1.2.0-dev\n"),
+	}
+	ch := writeChannel(t, output, archives)
+
+	if err := Push(context.Background(), PushConfig{Config: cfg, Channel: ch, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reg.tags["host-os-modules/ntp:1.1.0"]; !ok {
+		t.Fatalf("module is not tagged with its version, tags %v", reg.tags)
+	}
+
+	// pushing again is a no-op
+	if err := Push(context.Background(), PushConfig{Config: cfg, Channel: ch, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	idx, err := Pull(context.Background(), PullConfig{Config: cfg, Tag: "mcc-modules", Dest: dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Metadata.Name != "mcc-modules" || len(idx.Spec.Modules) != 3 {
+		t.Fatalf("unexpected pulled index %+v", idx)
+	}
+	// descriptions come from the archive metadata.yaml as the channel is not enriched
+	for _, m := range idx.Spec.Modules {
+		if want := m.Name + " module"; m.Description != want {
+			t.Errorf("module %s: expected description %q, got %q", m, want, m.Description)
+		}
+	}
+	for nv, data := range archives {
+		name, version, _ := strings.Cut(nv, "@")
+		bb, err := os.ReadFile(filepath.Join(dest, name+"-"+version+".tgz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bb) != data {
+			t.Errorf("unexpected archive %s contents", nv)
+		}
+	}
+	pulled, err := index.Read(context.Background(), filepath.Join(dest, "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pulled.Spec.Modules[2].Sha256Sum != sha(archives["sysctl@1.2.0-dev"]) {
+		t.Errorf("unexpected pulled index %+v", pulled)
+	}
+
+	// dev versions may be rebuilt, released ones must not be replaced
+	archives["sysctl@1.2.0-dev"] = moduleArchive(t, "sysctl", "# sysctl 1.2.0-dev rebuilt\n")
+	ch = writeChannel(t, output, archives)
+	if err := Push(context.Background(), PushConfig{Config: cfg, Channel: ch, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	archives["ntp@1.0.0"] = moduleArchive(t, "ntp", "# ntp 1.0.0 replaced\n")
+	ch = writeChannel(t, output, archives)
+	if err := Push(context.Background(), PushConfig{Config: cfg, Channel: ch, Output: output}); !errors.Is(err, ErrReleased) {
+		t.Fatalf("expected released error, got %v", err)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for s, want := range map[string]reference{
+		"localhost:5000/mosk/modules":         {registry: "localhost:5000", repository: "mosk/modules"},
+		"registry.example.com/modules:latest": {registry: "registry.example.com", repository: "modules", reference: "latest"},
+		"localhost:5000/modules@sha256:abc":   {registry: "localhost:5000", repository: "modules", reference: "sha256:abc"},
+	} {
+		got, err := parseReference(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", s, want, got)
+		}
+	}
+
+	for _, s := range []string{"modules", "localhost:5000/", "localhost:5000/Modules"} {
+		if _, err := parseReference(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
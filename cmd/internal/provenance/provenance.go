@@ -0,0 +1,221 @@
+package provenance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+const (
+	// Suffix is appended to an archive file name to get its provenance.
+	Suffix = ".provenance.json"
+
+	statementType = "https://in-toto.io/Statement/v1"
+	predicateType = "https://slsa.dev/provenance/v1"
+	buildType     = "https://github.com/Mirantis/host-os-modules/module-builder/v1"
+)
+
+type (
+	// Builder describes the tool and invocation producing archives.
+	Builder struct {
+		ID        string   // builder identifier
+		Version   string   // builder version
+		GoVersion string   // Go version the builder is compiled with
+		Args      []string // command-line flags and arguments used
+	}
+
+	// Source describes the git state archives are built from.
+	Source struct {
+		Repository string // git remote URL, may be empty
+		Commit     string // HEAD commit
+	}
+
+	// Statement is an in-toto statement with the SLSA provenance predicate.
+	Statement struct {
+		Type          string    `json:"_type"`
+		Subject       []Subject `json:"subject"`
+		PredicateType string    `json:"predicateType"`
+		Predicate     Predicate `json:"predicate"`
+	}
+
+	Subject struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	}
+
+	Predicate struct {
+		BuildDefinition BuildDefinition `json:"buildDefinition"`
+		RunDetails      RunDetails      `json:"runDetails"`
+	}
+
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   ExternalParameters   `json:"externalParameters"`
+		InternalParameters   InternalParameters   `json:"internalParameters"`
+		ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies"`
+	}
+
+	ExternalParameters struct {
+		Module  string   `json:"module"`
+		Version string   `json:"version"`
+		Args    []string `json:"args"`
+	}
+
+	InternalParameters struct {
+		Dirty bool `json:"dirty"` // module sources differ from the commit
+
+		// SourceVersion is the metadata.yaml version of the module sources
+		// if the builder bumps it to the version of the archive.
+		SourceVersion string `json:"sourceVersion,omitempty"`
+	}
+
+	ResourceDescriptor struct {
+		URI    string            `json:"uri,omitempty"`
+		Digest map[string]string `json:"digest"`
+	}
+
+	RunDetails struct {
+		Builder BuilderDetails `json:"builder"`
+	}
+
+	BuilderDetails struct {
+		ID      string            `json:"id"`
+		Version map[string]string `json:"version"`
+	}
+)
+
+// New returns the provenance statement of the module archive
+// built from sources in the state described by params.
+func New(b Builder, src Source, m domain.Module, params InternalParameters) Statement {
+	dependency := ResourceDescriptor{
+		Digest: map[string]string{"gitCommit": src.Commit},
+	}
+	if src.Repository != "" {
+		dependency.URI = "git+" + src.Repository
+	}
+
+	return Statement{
+		Type: statementType,
+		Subject: []Subject{{
+			Name:   m.ArchiveName(),
+			Digest: map[string]string{"sha256": m.Sha256Sum},
+		}},
+		PredicateType: predicateType,
+		Predicate: Predicate{
+			BuildDefinition: BuildDefinition{
+				BuildType: buildType,
+				ExternalParameters: ExternalParameters{
+					Module:  m.Name,
+					Version: m.Version,
+					Args:    b.Args,
+				},
+				InternalParameters:   params,
+				ResolvedDependencies: []ResourceDescriptor{dependency},
+			},
+			RunDetails: RunDetails{
+				Builder: BuilderDetails{
+					ID: b.ID,
+					Version: map[string]string{
+						b.ID: b.Version,
+						"go": b.GoVersion,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Write serializes the statement to the file.
+func Write(name string, st Statement) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(st); err != nil {
+		return fmt.Errorf("failed to serialize provenance: %w", err)
+	}
+
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Read deserializes the statement from the file.
+func Read(name string) (Statement, error) {
+	var st Statement
+
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return st, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(bb, &st); err != nil {
+		return st, fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+	}
+
+	return st, nil
+}
+
+// Verify checks that the statement describes the archive.
+func Verify(st Statement, archive string) error {
+	if st.Type != statementType || st.PredicateType != predicateType {
+		return fmt.Errorf("unexpected statement type %s with predicate %s", st.Type, st.PredicateType)
+	}
+
+	shasum, err := artifact.FileSha256(archive)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(archive)
+	for _, s := range st.Subject {
+		if s.Name != name {
+			continue
+		}
+		if s.Digest["sha256"] != shasum {
+			return fmt.Errorf("archive %s sha256sum %s does not match provenance %s", name, shasum, s.Digest["sha256"])
+		}
+		return nil
+	}
+
+	return fmt.Errorf("archive %s is not a subject of the provenance", name)
+}
+
+// GitSource determines the commit of the git working tree, the current
+// directory if empty.
+func GitSource(worktree string) (Source, error) {
+	var src Source
+
+	output, err := git.Run(worktree, "rev-parse", "HEAD")
+	if err != nil {
+		return src, err
+	}
+	src.Commit = strings.TrimSpace(output)
+
+	// remote is optional, e.g. for local clones
+	if output, err := git.Run(worktree, "remote", "get-url", "origin"); err == nil {
+		src.Repository = strings.TrimSpace(output)
+	}
+
+	return src, nil
+}
+
+// Dirty reports whether the directory of the git working tree, the current
+// directory if empty, has uncommitted changes, including untracked files,
+// compared to the HEAD commit.
+func Dirty(worktree, dir string) (bool, error) {
+	output, err := git.Run(worktree, "status", "--porcelain", "--untracked-files=all", "--", dir)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(output) != "", nil
+}
@@ -0,0 +1,147 @@
+package provenance
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git/gittest"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+var testBuilder = Builder{ID: "module-builder", Version: "v1.0.0", GoVersion: "go1.21.13", Args: []string{"-promote", "minor"}}
+
+// attest writes the archive and its provenance to a temporary directory.
+func attest(t *testing.T) (string, Statement) {
+	t.Helper()
+
+	m := domain.Module{NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: "1.1.0"}}
+	archive := filepath.Join(t.TempDir(), m.ArchiveName())
+	if err := os.WriteFile(archive, []byte("archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if m.Sha256Sum, err = artifact.FileSha256(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	src := Source{Repository: "https://example.com/modules.git", Commit: "0123456789abcdef"}
+	if err := Write(archive+Suffix, New(testBuilder, src, m, InternalParameters{SourceVersion: "1.0.1-dev"})); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := Read(archive + Suffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive, st
+}
+
+func TestVerify(t *testing.T) {
+	archive, st := attest(t)
+	if err := Verify(st, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	params := st.Predicate.BuildDefinition.InternalParameters
+	if params.Dirty || params.SourceVersion != "1.0.1-dev" {
+		t.Errorf("unexpected internal parameters %+v", params)
+	}
+	deps := st.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 1 || deps[0].URI != "git+https://example.com/modules.git" || deps[0].Digest["gitCommit"] != "0123456789abcdef" {
+		t.Errorf("unexpected resolved dependencies %+v", deps)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		tamper  func(t *testing.T, archive string, st *Statement)
+		wantErr string
+	}{
+		"sha mismatch": {
+			tamper: func(t *testing.T, archive string, _ *Statement) {
+				if err := os.WriteFile(archive, []byte("tampered"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "does not match provenance",
+		},
+		"tampered subject digest": {
+			tamper: func(_ *testing.T, _ string, st *Statement) {
+				st.Subject[0].Digest["sha256"] = strings.Repeat("0", 64)
+			},
+			wantErr: "does not match provenance",
+		},
+		"tampered subject name": {
+			tamper: func(_ *testing.T, _ string, st *Statement) {
+				st.Subject[0].Name = "ntp-1.2.0.tgz"
+			},
+			wantErr: "is not a subject of the provenance",
+		},
+		"unexpected predicate": {
+			tamper: func(_ *testing.T, _ string, st *Statement) {
+				st.PredicateType = "https://slsa.dev/provenance/v0.2"
+			},
+			wantErr: "unexpected statement type",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			archive, st := attest(t)
+			tc.tamper(t, archive, &st)
+
+			err := Verify(st, archive)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	repo := gittest.New(t, map[string]string{"ntp/metadata.yaml": "name: ntp\n"})
+	gittest.Run(t, repo, "remote", "add", "origin", "https://example.com/modules.git")
+
+	src, err := GitSource(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := gittest.Run(t, repo, "rev-parse", "HEAD"); src.Commit != want {
+		t.Errorf("expected commit %s, got %s", want, src.Commit)
+	}
+	if src.Repository != "https://example.com/modules.git" {
+		t.Errorf("unexpected repository %s", src.Repository)
+	}
+}
+
+func TestDirty(t *testing.T) {
+	for name, tc := range map[string]struct {
+		files map[string]string
+		want  bool
+	}{
+		"clean":               {nil, false},
+		"modified":            {map[string]string{"ntp/main.yaml": "- hosts: all\n"}, true},
+		"untracked":           {map[string]string{"ntp/templates/chrony.conf.j2": "server {{ server }}\n"}, true},
+		"other module":        {map[string]string{"sysctl/main.yaml": "- hosts: all\n"}, false},
+		"outside of a module": {map[string]string{"README.md": "# Modules\n"}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := gittest.New(t, map[string]string{
+				"ntp/metadata.yaml":    "name: ntp\n",
+				"ntp/main.yaml":        "---\n",
+				"sysctl/metadata.yaml": "name: sysctl\n",
+			})
+			gittest.Write(t, repo, tc.files)
+
+			got, err := Dirty(repo, filepath.Join(repo, "ntp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("expected dirty %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package prune
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	LogWriter  io.Writer // logger
+	ListWriter io.Writer // where modules to remove are listed before the index is updated, if set
+	Output     string    // where archives are stored
+	KeepMajors int       // latest majors to keep per module, all if zero
+	KeepMinors int       // latest minors to keep per major, all if zero
+	References []string  // HostOSConfiguration files with versions to keep
+	IndexFile  string    // index file to prune, index.yaml if empty
+	DryRun     bool      // only report entries to remove
+}
+
+// hostOSConfiguration is a minimal representation of the HostOSConfiguration
+// object required to determine used module versions.
+type hostOSConfiguration struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		Configs []struct {
+			Module        string `yaml:"module"`
+			ModuleVersion string `yaml:"moduleVersion"`
+		} `yaml:"configs"`
+	} `yaml:"spec"`
+}
+
+// Index removes modules not matching the retention policy from the index.yaml
+// along with their archives and sidecars, and returns the removed modules.
+func Index(ctx context.Context, cfg Config) ([]domain.Module, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	if cfg.IndexFile == "" {
+		cfg.IndexFile = domain.ReleaseIndexFileName
+	}
+
+	releaseIndexAbsPath, err := filepath.Abs(cfg.IndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine abs path for the %s: %w", cfg.IndexFile, err)
+	}
+
+	referenced, err := readReferences(cfg.References)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseIndex, err := index.Read(ctx, releaseIndexAbsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkReferences(referenced, releaseIndex.Spec.Modules); err != nil {
+		return nil, err
+	}
+
+	kept, pruned := policy(l, cfg, referenced, releaseIndex.Spec.Modules)
+	if err := list(cfg, pruned); err != nil {
+		return nil, err
+	}
+	if len(pruned) == 0 || cfg.DryRun {
+		return pruned, nil
+	}
+
+	l.Printf("Pruning %d modules from the %s", len(pruned), releaseIndexAbsPath)
+	releaseIndex.Spec.Modules = kept
+	if err := index.Write(ctx, releaseIndexAbsPath, releaseIndex); err != nil {
+		return nil, fmt.Errorf("failed to update release index: %w", err)
+	}
+
+	var merr error
+	for _, m := range pruned {
+		tgzName := filepath.Join(cfg.Output, m.ArchiveName())
+
+		// sidecars, e.g. signatures, provenances and SBOMs, are named after the archive
+		sidecars, err := filepath.Glob(tgzName + ".*")
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to list sidecars of %s: %w", tgzName, err))
+		}
+
+		for _, name := range append([]string{tgzName}, sidecars...) {
+			if err := os.Remove(name); err == nil {
+				l.Printf("Removed %s", name)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				merr = errors.Join(merr, fmt.Errorf("failed to remove %s: %w", name, err))
+			}
+		}
+	}
+
+	return pruned, merr
+}
+
+// list prints modules to remove to the list writer, if set.
+func list(cfg Config, pruned []domain.Module) error {
+	if cfg.ListWriter == nil {
+		return nil
+	}
+
+	verb := "Removing"
+	if cfg.DryRun {
+		verb = "Would remove"
+	}
+	for _, m := range pruned {
+		if _, err := fmt.Fprintf(cfg.ListWriter, "%s %s\n", verb, m); err != nil {
+			return fmt.Errorf("failed to list modules to remove: %w", err)
+		}
+	}
+	return nil
+}
+
+// policy splits modules into kept and pruned ones.
+func policy(l *log.Logger, cfg Config, referenced map[domain.NameVersionTuple]struct{}, modules []domain.Module) (kept, pruned []domain.Module) {
+	// distinct majors and minors of every module in descending order
+	type minor struct{ major, minor uint64 }
+	var (
+		majors = map[string][]uint64{}
+		minors = map[string][]minor{}
+	)
+	for _, m := range modules {
+		v, err := semver.NewVersion(m.Version)
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(majors[m.Name], v.Major()) {
+			majors[m.Name] = append(majors[m.Name], v.Major())
+		}
+		if mm := (minor{v.Major(), v.Minor()}); !slices.Contains(minors[m.Name], mm) {
+			minors[m.Name] = append(minors[m.Name], mm)
+		}
+	}
+	for name := range majors {
+		slices.SortFunc(majors[name], func(a, b uint64) int { return cmp.Compare(b, a) })
+		slices.SortFunc(minors[name], func(a, b minor) int {
+			if a.major != b.major {
+				return cmp.Compare(b.major, a.major)
+			}
+			return cmp.Compare(b.minor, a.minor)
+		})
+	}
+
+	for _, m := range modules {
+		v, err := semver.NewVersion(m.Version)
+		if err != nil {
+			l.Printf("WARNING: keeping module %s with malformed version: %v", m, err)
+			kept = append(kept, m)
+			continue
+		}
+
+		if _, ok := referenced[m.NameVersionTuple]; ok {
+			kept = append(kept, m)
+			continue
+		}
+
+		majorRank := slices.Index(majors[m.Name], v.Major())
+		minorRank := 0
+		for _, mm := range minors[m.Name] {
+			if mm.major == v.Major() {
+				if mm.minor == v.Minor() {
+					break
+				}
+				minorRank++
+			}
+		}
+
+		if (cfg.KeepMajors > 0 && majorRank >= cfg.KeepMajors) ||
+			(cfg.KeepMinors > 0 && minorRank >= cfg.KeepMinors) {
+			pruned = append(pruned, m)
+			continue
+		}
+
+		kept = append(kept, m)
+	}
+
+	return kept, pruned
+}
+
+// checkReferences fails if yanked module versions are referenced.
+func checkReferences(referenced map[domain.NameVersionTuple]struct{}, modules []domain.Module) error {
+	var merr error
+	for _, m := range modules {
+		if _, ok := referenced[m.NameVersionTuple]; ok && m.IsYanked() {
+			merr = errors.Join(merr, fmt.Errorf("%w: %s is referenced, but withdrawn: %s", domain.ErrYanked, m, m.YankReason))
+		}
+	}
+	return merr
+}
+
+// readReferences collects module versions used in the HostOSConfiguration files.
+func readReferences(files []string) (map[domain.NameVersionTuple]struct{}, error) {
+	referenced := map[domain.NameVersionTuple]struct{}{}
+	for _, name := range files {
+		bb, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		dec := yaml.NewDecoder(bytes.NewReader(bb))
+		for {
+			var hoc hostOSConfiguration
+			if err := dec.Decode(&hoc); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+			}
+
+			if hoc.Kind != "HostOSConfiguration" {
+				continue
+			}
+
+			for _, c := range hoc.Spec.Configs {
+				referenced[domain.NameVersionTuple{Name: c.Module, Version: c.ModuleVersion}] = struct{}{}
+			}
+		}
+	}
+
+	return referenced, nil
+}
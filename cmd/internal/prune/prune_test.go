@@ -0,0 +1,210 @@
+package prune
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+const references = `apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfiguration
+metadata:
+  name: ntp
+spec:
+  configs:
+  - module: ntp
+    moduleVersion: 1.0.0
+`
+
+// writeIndex writes the release index with modules of the given versions.
+func writeIndex(t *testing.T, dir string, modules ...domain.Module) string {
+	t.Helper()
+
+	var idx domain.HostOSConfigurationModules
+	idx.APIVersion = domain.HOCMAPIVersion
+	idx.Kind = domain.HOCMKind
+	idx.Metadata.Name = domain.ReleaseHOCMObjName
+	idx.Spec.Modules = modules
+
+	name := filepath.Join(dir, domain.ReleaseIndexFileName)
+	if err := index.Write(context.Background(), name, idx); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func module(name, version string) domain.Module {
+	return domain.Module{
+		NameVersionTuple: domain.NameVersionTuple{Name: name, Version: version},
+		Sha256Sum:        name + "-" + version,
+	}
+}
+
+func TestIndexYankedReference(t *testing.T) {
+	dir := t.TempDir()
+
+	yankedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	yanked := module("ntp", "1.0.0")
+	yanked.YankReason = "CVE-2026-0001"
+	yanked.YankedAt = &yankedAt
+	indexFile := writeIndex(t, dir, yanked, module("ntp", "2.0.0"))
+
+	refs := filepath.Join(dir, "hoc.yaml")
+	if err := os.WriteFile(refs, []byte(references), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Index(context.Background(), Config{
+		LogWriter:  io.Discard,
+		Output:     dir,
+		KeepMajors: 1,
+		References: []string{refs},
+		IndexFile:  indexFile,
+	})
+	if !errors.Is(err, domain.ErrYanked) {
+		t.Fatalf("expected %v, got %v", domain.ErrYanked, err)
+	}
+
+	after, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("index is modified:\n%s", after)
+	}
+}
+
+// sidecars are files written next to every archive.
+var sidecars = []string{".metadata.yaml", ".sig", ".provenance.json", ".spdx.json", ".cdx.json"}
+
+// writeArtifacts writes the index and archives with sidecars of the modules.
+func writeArtifacts(t *testing.T, dir string, modules ...domain.Module) string {
+	t.Helper()
+
+	for _, m := range modules {
+		for _, suffix := range append([]string{""}, sidecars...) {
+			if err := os.WriteFile(filepath.Join(dir, m.ArchiveName()+suffix), []byte(m.String()), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return writeIndex(t, dir, modules...)
+}
+
+func TestIndex(t *testing.T) {
+	modules := []domain.Module{
+		module("ntp", "1.0.0"),
+		module("ntp", "1.1.0"),
+		module("ntp", "1.2.0"),
+		module("ntp", "2.0.0"),
+		module("ntp", "2.1.0"),
+		module("sysctl", "1.0.0"),
+	}
+
+	for name, tc := range map[string]struct {
+		cfg        Config
+		references string
+		want       []string // pruned modules
+	}{
+		"keep all": {},
+		"keep majors": {
+			cfg:  Config{KeepMajors: 1},
+			want: []string{"ntp-1.0.0", "ntp-1.1.0", "ntp-1.2.0"},
+		},
+		"keep minors": {
+			cfg:  Config{KeepMinors: 1},
+			want: []string{"ntp-1.0.0", "ntp-1.1.0", "ntp-2.0.0"},
+		},
+		"keep majors and minors": {
+			cfg:  Config{KeepMajors: 1, KeepMinors: 1},
+			want: []string{"ntp-1.0.0", "ntp-1.1.0", "ntp-1.2.0", "ntp-2.0.0"},
+		},
+		"keep referenced": {
+			cfg:        Config{KeepMajors: 1, KeepMinors: 1},
+			references: references,
+			want:       []string{"ntp-1.1.0", "ntp-1.2.0", "ntp-2.0.0"},
+		},
+		"dry run": {
+			cfg:  Config{KeepMajors: 1, DryRun: true},
+			want: []string{"ntp-1.0.0", "ntp-1.1.0", "ntp-1.2.0"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			indexFile := writeArtifacts(t, dir, modules...)
+
+			cfg := tc.cfg
+			cfg.LogWriter = io.Discard
+			cfg.Output = dir
+			cfg.IndexFile = indexFile
+			if tc.references != "" {
+				refs := filepath.Join(t.TempDir(), "hoc.yaml")
+				if err := os.WriteFile(refs, []byte(tc.references), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				cfg.References = []string{refs}
+			}
+
+			var listed strings.Builder
+			cfg.ListWriter = &listed
+
+			pruned, err := Index(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, m := range pruned {
+				got = append(got, m.String())
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %v to be pruned, got %v", tc.want, got)
+			}
+
+			verb := "Removing"
+			if cfg.DryRun {
+				verb = "Would remove"
+			}
+			var wantListed strings.Builder
+			for _, m := range tc.want {
+				wantListed.WriteString(verb + " " + m + "\n")
+			}
+			if listed.String() != wantListed.String() {
+				t.Errorf("expected listed modules:\n%s\ngot:\n%s", &wantListed, &listed)
+			}
+
+			idx, err := index.Read(context.Background(), indexFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range modules {
+				removed := slices.Contains(tc.want, m.String()) && !cfg.DryRun
+				if listed := slices.ContainsFunc(idx.Spec.Modules, m.IsEqual); listed == removed {
+					t.Errorf("module %s: expected removed %t, but listed in the index %t", m, removed, listed)
+				}
+
+				for _, suffix := range append([]string{""}, sidecars...) {
+					name := m.ArchiveName() + suffix
+					_, err := os.Stat(filepath.Join(dir, name))
+					if exists := err == nil; exists == removed {
+						t.Errorf("%s: expected removed %t, but exists %t", name, removed, exists)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// AuthEnv is the environment variable with user:password credentials or a bearer token.
+const AuthEnv = "MODULE_BUILDER_PUBLISH_AUTH"
+
+// ErrReleased is returned on an attempt to overwrite a released artifact.
+var ErrReleased = errors.New("released artifact differs from the published one")
+
+type Config struct {
+	LogWriter io.Writer        // logger
+	BaseURL   string           // repository URL to put artifacts under
+	Output    string           // where archives are stored
+	Channels  []config.Channel // indexes to publish along with their archives
+	DryRun    bool             // only print artifacts to upload
+	Client    *http.Client     // HTTP client, http.DefaultClient if nil
+
+	// Auth is either user:password basic authentication
+	// credentials or a bearer token, disabled if empty.
+	Auth string
+}
+
+// Result holds names of published artifacts.
+type Result struct {
+	Uploaded []string `json:"uploaded"` // artifacts put to the repository
+	Skipped  []string `json:"skipped"`  // artifacts already present with the same sha256sum
+}
+
+type publisher struct {
+	logger  *log.Logger
+	client  *http.Client
+	baseURL string
+	auth    string
+	dryRun  bool
+
+	res Result
+}
+
+// artifactFile is a single file to publish.
+type artifactFile struct {
+	name     string
+	data     []byte
+	released bool // must never be overwritten once published
+
+	// sha256sum of the archive that is not built locally
+	// and must be published already, data is nil then.
+	published string
+}
+
+// Artifacts uploads archives referenced by channel indexes, their
+// sidecars, and then the indexes with their sidecars over HTTP PUT.
+// Referenced archives missing in the output directory must be published already.
+func Artifacts(ctx context.Context, cfg Config) (Result, error) {
+	p := &publisher{
+		logger:  log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile),
+		client:  cfg.Client,
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		auth:    cfg.Auth,
+		dryRun:  cfg.DryRun,
+		res:     Result{Uploaded: []string{}, Skipped: []string{}},
+	}
+	if p.client == nil {
+		p.client = http.DefaultClient
+	}
+
+	archives, indexes, err := collect(ctx, cfg)
+	if err != nil {
+		return p.res, err
+	}
+
+	var merr error
+	for _, f := range archives {
+		if err := p.put(f); err != nil {
+			merr = errors.Join(merr, err)
+		}
+	}
+	if merr != nil {
+		return p.res, merr // never publish indexes referencing missing archives
+	}
+
+	for _, f := range indexes {
+		if err := p.put(f); err != nil {
+			merr = errors.Join(merr, err)
+		}
+	}
+
+	return p.res, merr
+}
+
+// collect reads artifacts of all channels, archives and their
+// sidecars are returned once even if referenced by several indexes.
+func collect(ctx context.Context, cfg Config) (archives, indexes []artifactFile, err error) {
+	seen := map[string]bool{}
+	for _, ch := range cfg.Channels {
+		if _, err := os.Stat(ch.File); errors.Is(err, os.ErrNotExist) {
+			continue // channel is not populated yet
+		}
+
+		idx, err := index.Read(ctx, ch.File)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, m := range idx.Spec.Modules {
+			name := m.ArchiveName()
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			files, err := moduleFiles(cfg.Output, m)
+			if err != nil {
+				return nil, nil, err
+			}
+			archives = append(archives, files...)
+		}
+
+		data, err := os.ReadFile(ch.File)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", ch.File, err)
+		}
+		name := filepath.Base(ch.File)
+		indexes = append(indexes,
+			artifactFile{name: name, data: data},
+			artifactFile{name: name + artifact.SidecarSuffix, data: artifact.IndexSidecar(name).Marshal()},
+		)
+	}
+
+	return archives, indexes, nil
+}
+
+// moduleFiles returns the archive with its sidecar.
+func moduleFiles(output string, m domain.Module) ([]artifactFile, error) {
+	v, err := semver.StrictNewVersion(m.Version)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: malformed version: %w", m.NameVersionTuple, err)
+	}
+	released := v.Prerelease() == ""
+
+	name := m.ArchiveName()
+	sidecar := artifactFile{
+		name:     name + artifact.SidecarSuffix,
+		data:     artifact.ModuleSidecar(m).Marshal(),
+		released: released,
+	}
+
+	data, err := os.ReadFile(filepath.Join(output, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return []artifactFile{{name: name, released: released, published: m.Sha256Sum}, sidecar}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if shasum := sha256.Sum256(data); hex.EncodeToString(shasum[:]) != m.Sha256Sum {
+		return nil, fmt.Errorf("module %s: archive sha256sum %x does not match index %s", m.NameVersionTuple, shasum, m.Sha256Sum)
+	}
+
+	return []artifactFile{{name: name, data: data, released: released}, sidecar}, nil
+}
+
+// put uploads the file unless it is already published with the same sha256sum.
+func (p *publisher) put(f artifactFile) error {
+	u := p.baseURL + "/" + url.PathEscape(f.name)
+
+	remote, err := p.remoteSha256(u)
+	if err != nil {
+		return err
+	}
+
+	if f.published != "" {
+		if remote != f.published {
+			return fmt.Errorf("archive %s is neither built in the output directory nor published with sha256sum %s", f.name, f.published)
+		}
+		p.logger.Printf("Skipping %s, already published", f.name)
+		p.res.Skipped = append(p.res.Skipped, f.name)
+		return nil
+	}
+
+	sha256sum := sha256.Sum256(f.data)
+	sha1sum := sha1.Sum(f.data)
+	md5sum := md5.Sum(f.data)
+	shasum := hex.EncodeToString(sha256sum[:])
+
+	switch {
+	case remote == shasum:
+		p.logger.Printf("Skipping %s, already published", f.name)
+		p.res.Skipped = append(p.res.Skipped, f.name)
+		return nil
+	case remote != "" && f.released:
+		return fmt.Errorf("refusing to overwrite %s: %w, published %s, local %s", u, ErrReleased, remote, shasum)
+	}
+
+	p.res.Uploaded = append(p.res.Uploaded, f.name)
+	if p.dryRun {
+		p.logger.Printf("Would upload %s to %s", f.name, u)
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(f.data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Checksum-Sha256", shasum)
+	req.Header.Set("X-Checksum-Sha1", hex.EncodeToString(sha1sum[:]))
+	req.Header.Set("X-Checksum-Md5", hex.EncodeToString(md5sum[:]))
+	req.Header.Set("Content-Type", contentType(f.name))
+
+	resp, err := p.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to upload %s: %s: %s", u, resp.Status, readSnippet(resp.Body))
+	}
+
+	p.logger.Printf("Uploaded %s to %s", f.name, u)
+	return nil
+}
+
+// remoteSha256 returns the sha256sum of the published artifact, empty if it does not exist.
+func (p *publisher) remoteSha256(u string) (string, error) {
+	req, err := http.NewRequest(http.MethodHead, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", nil
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("failed to check %s: %s", u, resp.Status)
+	case resp.Header.Get("X-Checksum-Sha256") != "":
+		return strings.ToLower(resp.Header.Get("X-Checksum-Sha256")), nil
+	}
+
+	// the server does not report checksums, calculate it
+	req.Method = http.MethodGet
+	resp, err = p.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", u, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (p *publisher) do(req *http.Request) (*http.Response, error) {
+	if user, password, ok := strings.Cut(p.auth, ":"); ok {
+		req.SetBasicAuth(user, password)
+	} else if p.auth != "" {
+		req.Header.Set("Authorization", "Bearer "+p.auth)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+func contentType(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".tgz"):
+		return "application/gzip"
+	case strings.HasSuffix(name, ".yaml"):
+		return "application/yaml"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func readSnippet(r io.Reader) string {
+	bb, _ := io.ReadAll(io.LimitReader(r, 512))
+	return strings.TrimSpace(string(bb))
+}
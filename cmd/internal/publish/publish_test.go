@@ -0,0 +1,197 @@
+package publish
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+)
+
+// repository is an Artifactory stand-in keeping files in memory.
+type repository struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	puts  int
+}
+
+func (r *repository) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := strings.TrimPrefix(req.URL.Path, "/repo/")
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+		data, ok := r.files[name]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("X-Checksum-Sha256", sha(data))
+		_, _ = w.Write(data)
+	case http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Header.Get("X-Checksum-Sha256") != sha(data) {
+			http.Error(w, "checksum mismatch", http.StatusConflict)
+			return
+		}
+		r.files[name] = data
+		r.puts++
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type fixture struct {
+	dir      string
+	output   string
+	channels []config.Channel
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	f := &fixture{
+		dir:    dir,
+		output: filepath.Join(dir, "_artifacts"),
+		channels: []config.Channel{
+			{Name: "release", File: filepath.Join(dir, "index.yaml"), ObjectName: "mcc-modules", Stage: config.StageRelease},
+			{Name: "dev", File: filepath.Join(dir, "index-dev.yaml"), ObjectName: "dev-mcc-modules", Stage: config.StageDev},
+		},
+	}
+	if err := os.Mkdir(f.output, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f.build(t, "index.yaml", "mcc-modules", "1.0.0", "ntp release archive")
+	f.build(t, "index-dev.yaml", "dev-mcc-modules", "1.1.0-dev", "ntp dev archive")
+	return f
+}
+
+// build writes the ntp archive and the index referencing it.
+func (f *fixture) build(t *testing.T, indexName, objectName, version, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(f.output, "ntp-"+version+".tgz"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	index := fmt.Sprintf(`apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfigurationModules
+metadata:
+  name: %s
+spec:
+  modules:
+    - name: ntp
+      version: %s
+      sha256sum: %s
+`, objectName, version, sha([]byte(data)))
+	if err := os.WriteFile(filepath.Join(f.dir, indexName), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fixture) config(srv *httptest.Server) Config {
+	return Config{
+		LogWriter: io.Discard,
+		BaseURL:   srv.URL + "/repo",
+		Output:    f.output,
+		Channels:  f.channels,
+		Client:    srv.Client(),
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	repo := &repository{files: map[string][]byte{}}
+	srv := httptest.NewServer(repo)
+	defer srv.Close()
+
+	f := newFixture(t)
+
+	res, err := Artifacts(context.Background(), f.config(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Uploaded) != 8 || len(res.Skipped) != 0 {
+		t.Fatalf("expected 8 uploaded artifacts, got %+v", res)
+	}
+	if sidecar := string(repo.files["ntp-1.0.0.tgz.metadata.yaml"]); !strings.Contains(sidecar, "key: binary:bm:host-os-modules:ntp\n") {
+		t.Errorf("unexpected sidecar %q", sidecar)
+	}
+
+	res, err = Artifacts(context.Background(), f.config(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Uploaded) != 0 || len(res.Skipped) != 8 {
+		t.Fatalf("expected 8 skipped artifacts, got %+v", res)
+	}
+
+	// dev versions may be rebuilt
+	f.build(t, "index-dev.yaml", "dev-mcc-modules", "1.1.0-dev", "ntp rebuilt dev archive")
+	res, err = Artifacts(context.Background(), f.config(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Uploaded) != 3 {
+		t.Fatalf("expected dev archive, sidecar and index uploaded, got %+v", res)
+	}
+
+	// archives not built locally must be published
+	if err := os.Remove(filepath.Join(f.output, "ntp-1.0.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Artifacts(context.Background(), f.config(srv)); err != nil {
+		t.Fatal(err)
+	}
+	delete(repo.files, "ntp-1.0.0.tgz")
+	if _, err := Artifacts(context.Background(), f.config(srv)); err == nil {
+		t.Fatal("expected error for the archive missing everywhere")
+	}
+}
+
+func TestArtifactsReleased(t *testing.T) {
+	repo := &repository{files: map[string][]byte{}}
+	srv := httptest.NewServer(repo)
+	defer srv.Close()
+
+	f := newFixture(t)
+	if _, err := Artifacts(context.Background(), f.config(srv)); err != nil {
+		t.Fatal(err)
+	}
+	published := string(repo.files["index.yaml"])
+	puts := repo.puts
+
+	f.build(t, "index.yaml", "mcc-modules", "1.0.0", "ntp replaced release archive")
+	_, err := Artifacts(context.Background(), f.config(srv))
+	if !errors.Is(err, ErrReleased) {
+		t.Fatalf("expected released error, got %v", err)
+	}
+	if string(repo.files["ntp-1.0.0.tgz"]) != "ntp release archive" {
+		t.Error("released archive is overwritten")
+	}
+	if string(repo.files["index.yaml"]) != published || repo.puts != puts {
+		t.Error("artifacts are uploaded despite the failure")
+	}
+}
@@ -0,0 +1,234 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sign"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sort"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/version"
+)
+
+// CommitSubject is the subject of promote commits.
+const CommitSubject = "[promote] Release latest modules"
+
+// ErrDrift is returned if the build changes files committed to git.
+var ErrDrift = errors.New("build changes committed files")
+
+type Config struct {
+	LogWriter io.Writer     // logger
+	Build     module.Config // modules to build, Output is the artifacts directory, git runs in Dir
+
+	Clean     bool // remove the artifacts directory before the build
+	CheckDiff bool // fail if the build changes tracked files
+	Commit    bool // commit promoted modules and indexes
+}
+
+// Result describes the release pipeline run.
+type Result struct {
+	Build      module.Result             `json:"build"`
+	Sidecars   []string                  `json:"sidecars"`             // .metadata.yaml files
+	Indexes    []string                  `json:"indexes"`              // indexes copied to the artifacts directory
+	Signatures []string                  `json:"signatures,omitempty"` // detached signatures of copied indexes
+	Promoted   []domain.NameVersionTuple `json:"promoted,omitempty"`
+	Commit     string                    `json:"commit,omitempty"`
+}
+
+// Run builds modules and puts archives, sorted indexes and their sidecars
+// to the artifacts directory, signing the copied indexes if the build has
+// a signing key, then optionally checks that the build has not changed
+// the working tree or commits the promotion.
+func Run(ctx context.Context, cfg Config) (Result, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	res := Result{Sidecars: []string{}, Indexes: []string{}}
+
+	if cfg.Commit && cfg.Build.Promote == version.PromoteNone {
+		return res, errors.New("only promotions are committed")
+	}
+
+	dir := cfg.Build.Dir
+	output, err := abs(dir, cfg.Build.Output)
+	if err != nil {
+		return res, err
+	}
+	if cfg.Clean {
+		if err := clean(dir, output); err != nil {
+			return res, err
+		}
+	}
+	if err := os.MkdirAll(output, 0o755); err != nil {
+		return res, fmt.Errorf("failed to create %s: %w", output, err)
+	}
+
+	l.Printf("Building %d modules to %s", len(cfg.Build.Dirs), output)
+	built, err := module.Build(ctx, cfg.Build)
+	res.Build = built
+	if err != nil {
+		return res, fmt.Errorf("build failed: %w", err)
+	}
+
+	for _, m := range built.Modules {
+		name := m.Archive + artifact.SidecarSuffix
+		sidecar := artifact.ModuleSidecar(domain.Module{
+			NameVersionTuple: domain.NameVersionTuple{Name: m.Name, Version: m.NewVersion},
+			Sha256Sum:        m.Sha256Sum,
+		})
+		if err := os.WriteFile(name, sidecar.Marshal(), 0o644); err != nil {
+			return res, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		res.Sidecars = append(res.Sidecars, name)
+	}
+
+	var files []string
+	for _, ch := range cfg.Build.Channels {
+		file, err := abs(dir, ch.File)
+		if err != nil {
+			return res, err
+		}
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			continue // channel is not populated yet
+		}
+		files = append(files, file)
+	}
+
+	l.Printf("Sorting indexes")
+	if _, err := sort.Index(sort.Config{LogWriter: cfg.LogWriter, Files: files}); err != nil {
+		return res, err
+	}
+
+	for _, file := range files {
+		name := filepath.Join(output, filepath.Base(file))
+		l.Printf("Copying %s to %s", file, name)
+		if err := copyFile(file, name); err != nil {
+			return res, err
+		}
+		res.Indexes = append(res.Indexes, name)
+
+		sidecar := name + artifact.SidecarSuffix
+		if err := os.WriteFile(sidecar, artifact.IndexSidecar(name).Marshal(), 0o644); err != nil {
+			return res, fmt.Errorf("failed to write %s: %w", sidecar, err)
+		}
+		res.Sidecars = append(res.Sidecars, sidecar)
+
+		if key := cfg.Build.SigningKey; key != nil {
+			sigName := name + sign.Suffix
+			l.Printf("Signing %s to %s", name, sigName)
+			if err := sign.File(key, name, sigName); err != nil {
+				return res, fmt.Errorf("failed to sign %s: %w", name, err)
+			}
+			res.Signatures = append(res.Signatures, sigName)
+		}
+	}
+
+	if cfg.CheckDiff {
+		l.Printf("Checking the working tree for changes")
+		changed, err := git.Run(dir, "diff", "--name-only")
+		if err != nil {
+			return res, err
+		}
+		if changed = strings.TrimSpace(changed); changed != "" {
+			return res, fmt.Errorf("%w: %s", ErrDrift, strings.ReplaceAll(changed, "\n", ", "))
+		}
+	}
+
+	if cfg.Build.Promote != version.PromoteNone {
+		for _, m := range built.Modules {
+			if m.NewVersion != m.OldVersion {
+				res.Promoted = append(res.Promoted, domain.NameVersionTuple{Name: m.Name, Version: m.NewVersion})
+			}
+		}
+	}
+
+	if cfg.Commit {
+		if len(res.Promoted) == 0 {
+			return res, errors.New("no modules promoted, nothing to commit")
+		}
+
+		paths := append(append([]string{}, cfg.Build.Dirs...), files...)
+		if _, err := git.Run(dir, append([]string{"add", "--"}, paths...)...); err != nil {
+			return res, err
+		}
+
+		msg := CommitMessage(res.Promoted)
+		l.Printf("Committing %d promoted modules", len(res.Promoted))
+		if _, err := git.Run(dir, append([]string{"commit", "-m", msg, "--"}, paths...)...); err != nil {
+			return res, err
+		}
+
+		commit, err := git.Run(dir, "rev-parse", "HEAD")
+		if err != nil {
+			return res, err
+		}
+		res.Commit = strings.TrimSpace(commit)
+	}
+
+	return res, nil
+}
+
+// CommitMessage returns the message of the commit promoting modules.
+func CommitMessage(promoted []domain.NameVersionTuple) string {
+	var b strings.Builder
+	b.WriteString(CommitSubject + "\n\n")
+	for _, m := range promoted {
+		fmt.Fprintf(&b, "- %s %s\n", m.Name, m.Version)
+	}
+	return b.String()
+}
+
+// abs returns the absolute path, relative ones are resolved in the
+// working tree dir, the current directory if empty.
+func abs(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+
+	absName, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to determine abs path for the %s: %w", name, err)
+	}
+	return absName, nil
+}
+
+// clean removes the artifacts directory unless it contains
+// the working directory or the working tree dir.
+func clean(dir, output string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to determine working directory: %w", err)
+	}
+	tree, err := abs(dir, ".")
+	if err != nil {
+		return err
+	}
+	for _, d := range []string{wd, tree} {
+		if rel, err := filepath.Rel(output, d); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("refusing to clean %s containing the %s directory", output, d)
+		}
+	}
+
+	if err := os.RemoveAll(output); err != nil {
+		return fmt.Errorf("failed to clean %s: %w", output, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	bb, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	if err := os.WriteFile(dst, bb, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git/gittest"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/version"
+)
+
+const testMetadata = `name: ntp
+description: 'Module for NTP configuration'
+version: 1.0.1-dev
+valuesJsonSchema: schema.json
+docURL: https://example.com/ntp/README.md
+playbook: main.yaml
+`
+
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+
+	return gittest.New(t, map[string]string{
+		"ntp/metadata.yaml": testMetadata,
+		"ntp/main.yaml":     "---\n",
+		"ntp/schema.json":   "{}\n",
+	})
+}
+
+// testConfig returns the configuration building the ntp module of the
+// repository, relative paths are resolved in the repository rather than
+// in the current directory.
+func testConfig(t *testing.T, repo string, promote version.Promotion) Config {
+	t.Helper()
+
+	return Config{
+		LogWriter: io.Discard,
+		Build: module.Config{
+			LogWriter: io.Discard,
+			Dir:       repo,
+			Output:    "artifacts",
+			Dirs:      []string{"ntp"},
+			Promote:   promote,
+			Channels:  config.Default().Channels,
+		},
+		Clean: true,
+	}
+}
+
+func TestRunCheckDiff(t *testing.T) {
+	repo := newTestRepo(t)
+	gittest.Write(t, repo, map[string]string{".gitignore": "/artifacts/\n"})
+	gittest.Commit(t, repo, "ignore artifacts")
+
+	// the first build adds the module to the dev index
+	if _, err := Run(context.Background(), testConfig(t, repo, version.PromoteNone)); err != nil {
+		t.Fatal(err)
+	}
+	gittest.Commit(t, repo, "add ntp to the dev index")
+
+	cfg := testConfig(t, repo, version.PromoteNone)
+	cfg.CheckDiff = true
+	res, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(repo, "artifacts", domain.DevIndexFileName)}; !slices.Equal(res.Indexes, want) {
+		t.Errorf("expected indexes %v, got %v", want, res.Indexes)
+	}
+
+	// the committed index differs from the built one
+	gittest.Write(t, repo, map[string]string{domain.DevIndexFileName: "spec:\n  modules: []\n"})
+	gittest.Commit(t, repo, "drop ntp from the dev index")
+
+	_, err = Run(context.Background(), cfg)
+	if !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), domain.DevIndexFileName) {
+		t.Fatalf("expected %v of %s, got %v", ErrDrift, domain.DevIndexFileName, err)
+	}
+}
+
+func TestRunCommit(t *testing.T) {
+	repo := newTestRepo(t)
+	before := gittest.Run(t, repo, "rev-parse", "HEAD")
+
+	cfg := testConfig(t, repo, version.PromoteMinor)
+	cfg.Commit = true
+	res, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []domain.NameVersionTuple{{Name: "ntp", Version: "1.1.0"}}
+	if !slices.Equal(res.Promoted, want) {
+		t.Fatalf("expected promoted %v, got %v", want, res.Promoted)
+	}
+	if head := gittest.Run(t, repo, "rev-parse", "HEAD"); res.Commit != head || head == before {
+		t.Fatalf("expected the promote commit on top of %s, got %s with HEAD %s", before, res.Commit, head)
+	}
+	if msg := gittest.Run(t, repo, "log", "-1", "--format=%B"); msg != strings.TrimSpace(CommitMessage(want)) {
+		t.Errorf("unexpected commit message:\n%s", msg)
+	}
+
+	committed := strings.Fields(gittest.Run(t, repo, "diff-tree", "--no-commit-id", "--name-only", "-r", "HEAD"))
+	if want := []string{domain.DevIndexFileName, domain.ReleaseIndexFileName, "ntp/metadata.yaml"}; !slices.Equal(committed, want) {
+		t.Errorf("expected committed files %v, got %v", want, committed)
+	}
+	// artifacts are not committed
+	if status := gittest.Run(t, repo, "status", "--porcelain"); status != "?? artifacts/" {
+		t.Errorf("unexpected working tree status %q", status)
+	}
+}
+
+func TestRunCommitRequiresPromotion(t *testing.T) {
+	cfg := testConfig(t, t.TempDir(), version.PromoteNone)
+	cfg.Commit = true
+	if _, err := Run(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "only promotions are committed") {
+		t.Fatalf("expected error committing without promotion, got %v", err)
+	}
+}
+
+func TestRunCleanRefusesWorkingTree(t *testing.T) {
+	repo := newTestRepo(t)
+
+	cfg := testConfig(t, repo, version.PromoteNone)
+	cfg.Build.Output = "."
+	if _, err := Run(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "refusing to clean") {
+		t.Fatalf("expected error cleaning the working tree, got %v", err)
+	}
+	if status := gittest.Run(t, repo, "status", "--porcelain"); status != "" {
+		t.Errorf("unexpected working tree status %q", status)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	got := CommitMessage([]domain.NameVersionTuple{{Name: "ntp", Version: "1.1.0"}, {Name: "sysctl", Version: "2.0.0"}})
+	want := CommitSubject + "\n\n- ntp 1.1.0\n- sysctl 2.0.0\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,146 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned if no module version satisfies the constraint.
+var ErrNotFound = errors.New("no matching module version")
+
+type Config struct {
+	LogWriter  io.Writer        // logger
+	Name       string           // module name
+	Constraint string           // semver constraint, e.g. 1.x or >= 1.2, < 2
+	Channels   []config.Channel // channels to search in
+	Dev        bool             // search in dev channels as well
+	ModulesDir string           // directory with module sources to read deprecates from, skipped if empty
+}
+
+// Module returns the newest module version satisfying the constraint,
+// skipping deprecated and yanked versions.
+func Module(ctx context.Context, cfg Config) (domain.Module, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	constraint, err := semver.NewConstraint(cfg.Constraint)
+	if err != nil {
+		return domain.Module{}, fmt.Errorf("malformed constraint %q: %w", cfg.Constraint, err)
+	}
+
+	deprecated, err := readDeprecates(cfg.ModulesDir, cfg.Name)
+	if err != nil {
+		return domain.Module{}, err
+	}
+
+	var candidates []domain.Module
+	for _, ch := range cfg.Channels {
+		if ch.Stage == config.StageDev && !cfg.Dev {
+			continue
+		}
+
+		l.Printf("Searching module %s in the %s channel", cfg.Name, ch.Name)
+		idx, err := index.Read(ctx, ch.File)
+		if err != nil {
+			return domain.Module{}, fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+
+		for _, m := range idx.Spec.Modules {
+			if m.Name != cfg.Name {
+				continue
+			}
+			for _, d := range m.Deprecates {
+				deprecated[d.Version] = struct{}{}
+			}
+			candidates = append(candidates, m)
+		}
+	}
+
+	var (
+		found   domain.Module
+		version *semver.Version
+	)
+	for _, m := range candidates {
+		v, err := semver.NewVersion(m.Version)
+		if err != nil {
+			l.Printf("WARNING: skipping module %s with malformed version: %v", m, err)
+			continue
+		}
+
+		if !check(constraint, v) || (version != nil && !v.GreaterThan(version)) {
+			continue
+		}
+
+		if m.IsYanked() {
+			l.Printf("Skipping yanked module %s: %s", m, m.YankReason)
+			continue
+		}
+
+		if _, ok := deprecated[m.Version]; ok {
+			l.Printf("Skipping deprecated module %s", m)
+			continue
+		}
+
+		found, version = m, v
+	}
+
+	if version == nil {
+		return domain.Module{}, fmt.Errorf("%s %s: %w", cfg.Name, cfg.Constraint, ErrNotFound)
+	}
+
+	return found, nil
+}
+
+// check reports whether the version satisfies the constraint, prerelease
+// versions are checked by their version core unless the constraint
+// explicitly targets prereleases.
+func check(constraint *semver.Constraints, v *semver.Version) bool {
+	if constraint.Check(v) {
+		return true
+	}
+	if v.Prerelease() == "" {
+		return false
+	}
+
+	core := semver.New(v.Major(), v.Minor(), v.Patch(), "", "")
+	return constraint.Check(core)
+}
+
+// readDeprecates reads versions deprecated in the module metadata.yaml.
+func readDeprecates(modulesDir, name string) (map[string]struct{}, error) {
+	deprecated := map[string]struct{}{}
+	if modulesDir == "" {
+		return deprecated, nil
+	}
+
+	fileName := filepath.Join(modulesDir, name, "metadata.yaml")
+	bb, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return deprecated, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fileName, err)
+	}
+
+	var meta domain.Metadata
+	if err := yaml.Unmarshal(bb, &meta); err != nil {
+		return nil, fmt.Errorf("failed to deserialize yaml %s: %w", fileName, err)
+	}
+
+	for _, d := range meta.Deprecates {
+		deprecated[d.Version] = struct{}{}
+	}
+
+	return deprecated, nil
+}
@@ -0,0 +1,129 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+func module(name, version string) domain.Module {
+	return domain.Module{
+		NameVersionTuple: domain.NameVersionTuple{Name: name, Version: version},
+		Sha256Sum:        name + "-" + version,
+	}
+}
+
+// writeChannels writes the release and dev indexes with the modules
+// and the ntp metadata.yaml deprecating 1.2.0.
+func writeChannels(t *testing.T) (string, []config.Channel) {
+	t.Helper()
+
+	dir := t.TempDir()
+	yankedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	yanked := module("ntp", "1.3.0")
+	yanked.YankReason = "CVE-2026-0001"
+	yanked.YankedAt = &yankedAt
+	indexDeprecated := module("ntp", "2.1.0")
+	indexDeprecated.Deprecates = []domain.Deprecation{{Version: "2.0.0"}}
+
+	channels := config.Default().Channels
+	for i, modules := range [][]domain.Module{
+		{
+			module("ntp", "1.0.0"),
+			module("ntp", "1.1.0"),
+			module("ntp", "1.2.0"),
+			yanked,
+			module("ntp", "2.0.0"),
+			indexDeprecated,
+			module("sysctl", "3.0.0"),
+		},
+		{
+			module("ntp", "1.1.1-dev"),
+			module("ntp", "2.2.0-dev"),
+		},
+	} {
+		channels[i].File = filepath.Join(dir, channels[i].File)
+		if err := index.Write(context.Background(), channels[i].File, index.New("", channels[i].ObjectName, modules)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metadata := "name: ntp\nversion: 2.2.0-dev\ndeprecates:\n- version: 1.2.0\n"
+	if err := os.MkdirAll(filepath.Join(dir, "ntp"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ntp", "metadata.yaml"), []byte(metadata), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, channels
+}
+
+func TestModule(t *testing.T) {
+	dir, channels := writeChannels(t)
+
+	for name, tc := range map[string]struct {
+		constraint string
+		dev        bool
+		modulesDir string
+		want       string
+	}{
+		"exact":                 {constraint: "1.1.0", want: "1.1.0"},
+		"range":                 {constraint: ">= 1.0.0, < 1.2.0", want: "1.1.0"},
+		"wildcard skips yanked": {constraint: "1.x", want: "1.2.0"},
+		"metadata deprecation":  {constraint: "1.x", modulesDir: dir, want: "1.1.0"},
+		"missing metadata":      {constraint: "1.x", modulesDir: t.TempDir(), want: "1.2.0"},
+		"index deprecation":     {constraint: "2.0.x", want: ""},
+		"newest release":        {constraint: ">= 2", want: "2.1.0"},
+		"newest dev":            {constraint: ">= 2", dev: true, want: "2.2.0-dev"},
+		"dev prerelease":        {constraint: "~1.1.0", dev: true, want: "1.1.1-dev"},
+		"dev channel ignored":   {constraint: "~1.1.0", want: "1.1.0"},
+		"no match":              {constraint: "3", want: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := Module(context.Background(), Config{
+				LogWriter:  io.Discard,
+				Name:       "ntp",
+				Constraint: tc.constraint,
+				Channels:   channels,
+				Dev:        tc.dev,
+				ModulesDir: tc.modulesDir,
+			})
+			if tc.want == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("expected %v, got %v, %s", ErrNotFound, err, m)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Name != "ntp" || m.Version != tc.want || m.Sha256Sum != "ntp-"+tc.want {
+				t.Errorf("expected ntp %s, got %+v", tc.want, m)
+			}
+		})
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	_, channels := writeChannels(t)
+
+	if _, err := Module(context.Background(), Config{LogWriter: io.Discard, Name: "ntp", Constraint: "not a constraint", Channels: channels}); err == nil || !strings.Contains(err.Error(), "malformed constraint") {
+		t.Errorf("expected malformed constraint error, got %v", err)
+	}
+
+	channels[0].File = filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := Module(context.Background(), Config{LogWriter: io.Discard, Name: "ntp", Constraint: "1.x", Channels: channels}); err == nil || !strings.Contains(err.Error(), "channel release") {
+		t.Errorf("expected error reading the release channel, got %v", err)
+	}
+}
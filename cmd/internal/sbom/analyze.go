@@ -0,0 +1,238 @@
+package sbom
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Report is a bill of materials of a single module archive.
+	Report struct {
+		Module         domain.Module
+		Files          []File    // every packed file
+		AnsibleModules []File    // custom Ansible modules shipped in library/
+		Packages       []Package // OS packages installed by the playbook
+	}
+
+	// File is a packed file with its hashes.
+	File struct {
+		Path   string
+		Sha1   string
+		Sha256 string
+	}
+
+	// Package is an OS package installed by an apt or package task.
+	Package struct {
+		Name     string
+		Version  string // pinned version, empty if not pinned
+		Manager  string // apt or package
+		TaskFile string // file with the task
+		Dynamic  bool   // name is an expression evaluated on runtime, e.g. from module values
+	}
+)
+
+// libraryDir is the directory with custom Ansible modules.
+const libraryDir = "library/"
+
+var (
+	packageTaskKeys = map[string]string{
+		"apt":                     "apt",
+		"ansible.builtin.apt":     "apt",
+		"package":                 "package",
+		"ansible.builtin.package": "package",
+	}
+	varsKeys = []string{"vars", "set_fact", "ansible.builtin.set_fact"}
+
+	singleVarRe = regexp.MustCompile(`^\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}$`)
+)
+
+// Analyze reads the module archive and statically collects its materials.
+func Analyze(archive string, m domain.Module) (Report, error) {
+	r := Report{Module: m}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return r, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return r, fmt.Errorf("failed to read gzip %s: %w", archive, err)
+	}
+	defer gr.Close()
+
+	docs := map[string][]*yaml.Node{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return r, fmt.Errorf("failed to read tar %s: %w", archive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return r, fmt.Errorf("failed to read %s from %s: %w", header.Name, archive, err)
+		}
+
+		sha1sum, sha256sum := sha1.Sum(data), sha256.Sum256(data)
+		file := File{
+			Path:   header.Name,
+			Sha1:   hex.EncodeToString(sha1sum[:]),
+			Sha256: hex.EncodeToString(sha256sum[:]),
+		}
+		r.Files = append(r.Files, file)
+
+		if strings.HasPrefix(header.Name, libraryDir) && path.Ext(header.Name) == ".py" {
+			r.AnsibleModules = append(r.AnsibleModules, file)
+		}
+
+		if ext := path.Ext(header.Name); ext == ".yaml" || ext == ".yml" {
+			docs[header.Name] = decodeAll(data)
+		}
+	}
+
+	r.Packages = packages(docs)
+	return r, nil
+}
+
+// decodeAll decodes every YAML document, malformed ones (e.g. Jinja templates) are skipped.
+func decodeAll(data []byte) []*yaml.Node {
+	var nodes []*yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			return nodes
+		}
+		nodes = append(nodes, &node)
+	}
+}
+
+// packages finds apt and package tasks resolving package names
+// from variables defined in the playbook when possible.
+func packages(docs map[string][]*yaml.Node) []Package {
+	files := make([]string, 0, len(docs))
+	for name := range docs {
+		files = append(files, name)
+	}
+	slices.Sort(files)
+
+	// variables defined anywhere in the module
+	vars := map[string][]string{}
+	for _, name := range files {
+		for _, doc := range docs[name] {
+			walk(doc, func(key string, value *yaml.Node) {
+				if !slices.Contains(varsKeys, key) || value.Kind != yaml.MappingNode {
+					return
+				}
+				for i := 0; i+1 < len(value.Content); i += 2 {
+					if values := scalars(value.Content[i+1]); values != nil {
+						vars[value.Content[i].Value] = values
+					}
+				}
+			})
+		}
+	}
+
+	var result []Package
+	for _, name := range files {
+		for _, doc := range docs[name] {
+			walk(doc, func(key string, value *yaml.Node) {
+				manager, ok := packageTaskKeys[key]
+				if !ok || value.Kind != yaml.MappingNode {
+					return
+				}
+
+				var names []string
+				for i := 0; i+1 < len(value.Content); i += 2 {
+					switch value.Content[i].Value {
+					case "name", "pkg":
+						names = scalars(value.Content[i+1])
+					case "state":
+						if value.Content[i+1].Value == "absent" {
+							return
+						}
+					}
+				}
+
+				for _, n := range names {
+					for _, resolved := range resolve(n, vars) {
+						p := Package{Manager: manager, TaskFile: name}
+						p.Name, p.Version, _ = strings.Cut(resolved, "=")
+						p.Dynamic = strings.Contains(resolved, "{{")
+						if p.Dynamic {
+							p.Name, p.Version = resolved, ""
+						}
+						if !slices.Contains(result, p) {
+							result = append(result, p)
+						}
+					}
+				}
+			})
+		}
+	}
+
+	return result
+}
+
+func resolve(name string, vars map[string][]string) []string {
+	if m := singleVarRe.FindStringSubmatch(name); m != nil {
+		if values, ok := vars[m[1]]; ok {
+			return values
+		}
+	}
+	return []string{name}
+}
+
+// walk calls fn for every key-value pair of every mapping in the tree.
+func walk(node *yaml.Node, fn func(key string, value *yaml.Node)) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fn(node.Content[i].Value, node.Content[i+1])
+		}
+	}
+	for _, child := range node.Content {
+		walk(child, fn)
+	}
+}
+
+// scalars returns the scalar or a list of scalars, nil otherwise.
+func scalars(node *yaml.Node) []string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil
+			}
+			values = append(values, item.Value)
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,297 @@
+package sbom
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Format is a bill of materials document format.
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// Suffix returns the suffix appended to an archive file name
+// to get its bill of materials.
+func (f Format) Suffix() string {
+	if f == FormatCycloneDX {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+const (
+	toolName  = "module-builder"
+	namespace = "https://github.com/Mirantis/host-os-modules/sbom/"
+
+	propertyPrefix = "host-os-modules:"
+)
+
+// Write serializes the report in the given format.
+func (r Report) Write(w io.Writer, format Format, created time.Time) error {
+	var doc any
+	switch format {
+	case FormatSPDX:
+		doc = r.spdx(created)
+	case FormatCycloneDX:
+		doc = r.cycloneDX(created)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func purl(p Package) string {
+	s := "pkg:deb/ubuntu/" + p.Name
+	if p.Version != "" {
+		s += "@" + p.Version
+	}
+	return s
+}
+
+type (
+	spdxDocument struct {
+		SPDXVersion       string             `json:"spdxVersion"`
+		DataLicense       string             `json:"dataLicense"`
+		SPDXID            string             `json:"SPDXID"`
+		Name              string             `json:"name"`
+		DocumentNamespace string             `json:"documentNamespace"`
+		CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+		Packages          []spdxPackage      `json:"packages"`
+		Files             []spdxFile         `json:"files"`
+		Relationships     []spdxRelationship `json:"relationships"`
+	}
+
+	spdxCreationInfo struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	}
+
+	spdxPackage struct {
+		SPDXID           string                `json:"SPDXID"`
+		Name             string                `json:"name"`
+		VersionInfo      string                `json:"versionInfo,omitempty"`
+		PackageFileName  string                `json:"packageFileName,omitempty"`
+		DownloadLocation string                `json:"downloadLocation"`
+		FilesAnalyzed    bool                  `json:"filesAnalyzed"`
+		VerificationCode *spdxVerificationCode `json:"packageVerificationCode,omitempty"`
+		Checksums        []spdxChecksum        `json:"checksums,omitempty"`
+		ExternalRefs     []spdxExternalRef     `json:"externalRefs,omitempty"`
+		Comment          string                `json:"comment,omitempty"`
+	}
+
+	spdxVerificationCode struct {
+		Value string `json:"packageVerificationCodeValue"`
+	}
+
+	spdxFile struct {
+		SPDXID    string         `json:"SPDXID"`
+		FileName  string         `json:"fileName"`
+		Checksums []spdxChecksum `json:"checksums"`
+		FileTypes []string       `json:"fileTypes,omitempty"`
+		Comment   string         `json:"comment,omitempty"`
+	}
+
+	spdxChecksum struct {
+		Algorithm string `json:"algorithm"`
+		Value     string `json:"checksumValue"`
+	}
+
+	spdxExternalRef struct {
+		Category string `json:"referenceCategory"`
+		Type     string `json:"referenceType"`
+		Locator  string `json:"referenceLocator"`
+	}
+
+	spdxRelationship struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	}
+)
+
+// spdxID replaces characters not allowed in SPDX identifiers.
+func spdxID(kind, name string) string {
+	return "SPDXRef-" + kind + "-" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+func (r Report) spdx(created time.Time) spdxDocument {
+	moduleID := spdxID("Package", r.Module.Name)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              r.Module.String(),
+		DocumentNamespace: namespace + r.Module.String() + "-" + r.Module.Sha256Sum,
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName},
+		},
+		Relationships: []spdxRelationship{{Element: "SPDXRef-DOCUMENT", Type: "DESCRIBES", Related: moduleID}},
+	}
+
+	sha1s := make([]string, 0, len(r.Files))
+	for i, f := range r.Files {
+		id := spdxID("File", fmt.Sprintf("%d-%s", i, f.Path))
+		file := spdxFile{
+			SPDXID:   id,
+			FileName: "./" + f.Path,
+			Checksums: []spdxChecksum{
+				{Algorithm: "SHA1", Value: f.Sha1},
+				{Algorithm: "SHA256", Value: f.Sha256},
+			},
+		}
+		if slices.Contains(r.AnsibleModules, f) {
+			file.FileTypes = []string{"SOURCE"}
+			file.Comment = "custom Ansible module"
+		}
+		doc.Files = append(doc.Files, file)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: moduleID, Type: "CONTAINS", Related: id})
+		sha1s = append(sha1s, f.Sha1)
+	}
+
+	// see SPDX 2.3 clause 7.9 for the verification code algorithm
+	slices.Sort(sha1s)
+	verification := sha1.Sum([]byte(strings.Join(sha1s, "")))
+
+	doc.Packages = append(doc.Packages, spdxPackage{
+		SPDXID:           moduleID,
+		Name:             r.Module.Name,
+		VersionInfo:      r.Module.Version,
+		PackageFileName:  r.Module.ArchiveName(),
+		DownloadLocation: "NOASSERTION",
+		FilesAnalyzed:    true,
+		VerificationCode: &spdxVerificationCode{Value: hex.EncodeToString(verification[:])},
+		Checksums:        []spdxChecksum{{Algorithm: "SHA256", Value: r.Module.Sha256Sum}},
+	})
+
+	for i, p := range r.Packages {
+		id := spdxID("Package", fmt.Sprintf("%s-%d-%s", p.Manager, i, p.Name))
+		pkg := spdxPackage{
+			SPDXID:           id,
+			Name:             p.Name,
+			VersionInfo:      p.Version,
+			DownloadLocation: "NOASSERTION",
+			Comment:          fmt.Sprintf("installed by the %s task in %s", p.Manager, p.TaskFile),
+		}
+		if p.Dynamic {
+			pkg.Comment += ", the name is evaluated on runtime"
+		} else {
+			pkg.ExternalRefs = []spdxExternalRef{{Category: "PACKAGE-MANAGER", Type: "purl", Locator: purl(p)}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: moduleID, Type: "DEPENDS_ON", Related: id})
+	}
+
+	return doc
+}
+
+type (
+	cdxDocument struct {
+		BOMFormat   string         `json:"bomFormat"`
+		SpecVersion string         `json:"specVersion"`
+		Version     int            `json:"version"`
+		Metadata    cdxMetadata    `json:"metadata"`
+		Components  []cdxComponent `json:"components"`
+	}
+
+	cdxMetadata struct {
+		Timestamp string       `json:"timestamp"`
+		Tools     cdxTools     `json:"tools"`
+		Component cdxComponent `json:"component"`
+	}
+
+	cdxTools struct {
+		Components []cdxComponent `json:"components"`
+	}
+
+	cdxComponent struct {
+		Type       string        `json:"type"`
+		BOMRef     string        `json:"bom-ref,omitempty"`
+		Name       string        `json:"name"`
+		Version    string        `json:"version,omitempty"`
+		PURL       string        `json:"purl,omitempty"`
+		Hashes     []cdxHash     `json:"hashes,omitempty"`
+		Properties []cdxProperty `json:"properties,omitempty"`
+	}
+
+	cdxHash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+
+	cdxProperty struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+)
+
+func (r Report) cycloneDX(created time.Time) cdxDocument {
+	doc := cdxDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: toolName}}},
+			Component: cdxComponent{
+				Type:    "application",
+				BOMRef:  r.Module.String(),
+				Name:    r.Module.Name,
+				Version: r.Module.Version,
+				Hashes:  []cdxHash{{Alg: "SHA-256", Content: r.Module.Sha256Sum}},
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	for _, f := range r.Files {
+		c := cdxComponent{
+			Type:   "file",
+			BOMRef: "file:" + f.Path,
+			Name:   f.Path,
+			Hashes: []cdxHash{{Alg: "SHA-1", Content: f.Sha1}, {Alg: "SHA-256", Content: f.Sha256}},
+		}
+		if slices.Contains(r.AnsibleModules, f) {
+			c.Properties = []cdxProperty{{Name: propertyPrefix + "ansible-module", Value: "true"}}
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	for i, p := range r.Packages {
+		c := cdxComponent{
+			Type:    "library",
+			BOMRef:  fmt.Sprintf("package:%d:%s", i, p.Name),
+			Name:    p.Name,
+			Version: p.Version,
+			Properties: []cdxProperty{
+				{Name: propertyPrefix + "package-manager", Value: p.Manager},
+				{Name: propertyPrefix + "task-file", Value: p.TaskFile},
+			},
+		}
+		if p.Dynamic {
+			c.Properties = append(c.Properties, cdxProperty{Name: propertyPrefix + "dynamic", Value: "true"})
+		} else {
+			c.PURL = purl(p)
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	return doc
+}
@@ -0,0 +1,140 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+type Config struct {
+	LogWriter io.Writer      // logger
+	Channel   config.Channel // channel with modules to describe if no archives given, yanked ones are refused
+	Output    string         // where archives are stored
+	Archives  []string       // archives to describe
+	Format    Format         // document format
+	Created   time.Time      // document creation time
+}
+
+// Generate writes a bill of materials next to every archive
+// and returns the written file names.
+func Generate(ctx context.Context, cfg Config) ([]string, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	if cfg.Format != FormatSPDX && cfg.Format != FormatCycloneDX {
+		return nil, fmt.Errorf("unknown format %q, expected one of [%s, %s]", cfg.Format, FormatSPDX, FormatCycloneDX)
+	}
+
+	modules, err := collect(ctx, l, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		merr    error
+		written []string
+	)
+	archives := make([]string, 0, len(modules))
+	for archive := range modules {
+		archives = append(archives, archive)
+	}
+	slices.Sort(archives)
+	for _, archive := range archives {
+		m := modules[archive]
+		l.Printf("Analyzing module %s archive %s", m, archive)
+		report, err := Analyze(archive, m)
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("module %s: %w", m, err))
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := report.Write(&buf, cfg.Format, cfg.Created); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("module %s: %w", m, err))
+			continue
+		}
+
+		name := archive + cfg.Format.Suffix()
+		if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("failed to write %s: %w", name, err))
+			continue
+		}
+		written = append(written, name)
+	}
+
+	return written, merr
+}
+
+// collect maps archives to describe to their modules. Archives of
+// versions yanked in the channel are refused.
+func collect(ctx context.Context, l *log.Logger, cfg Config) (map[string]domain.Module, error) {
+	var idx domain.HostOSConfigurationModules
+	if cfg.Channel.File != "" {
+		var err error
+		idx, err = index.Read(ctx, cfg.Channel.File)
+		if err != nil && (len(cfg.Archives) == 0 || !errors.Is(err, os.ErrNotExist)) {
+			return nil, err
+		}
+	}
+
+	yanked := map[domain.NameVersionTuple]domain.Module{}
+	for _, m := range idx.Spec.Modules {
+		if m.IsYanked() {
+			yanked[m.NameVersionTuple] = m
+		}
+	}
+
+	modules := map[string]domain.Module{}
+	if len(cfg.Archives) > 0 {
+		var merr error
+		for _, archive := range cfg.Archives {
+			tuple, err := artifact.ParseArchiveName(archive)
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := yanked[tuple]; ok {
+				merr = errors.Join(merr, fmt.Errorf("%w: %s is withdrawn: %s", domain.ErrYanked, m, m.YankReason))
+				continue
+			}
+			shasum, err := artifact.FileSha256(archive)
+			if err != nil {
+				return nil, err
+			}
+			modules[archive] = domain.Module{NameVersionTuple: tuple, Sha256Sum: shasum}
+		}
+		return modules, merr
+	}
+
+	var merr error
+	for _, m := range idx.Spec.Modules {
+		if m.IsYanked() {
+			l.Printf("Skipping yanked module %s: %s", m, m.YankReason)
+			continue
+		}
+
+		archive := filepath.Join(cfg.Output, m.ArchiveName())
+		shasum, err := artifact.FileSha256(archive)
+		if err != nil {
+			merr = errors.Join(merr, fmt.Errorf("module %s: %w", m, err))
+			continue
+		}
+		if shasum != m.Sha256Sum {
+			merr = errors.Join(merr, fmt.Errorf("module %s: archive sha256sum %s does not match index %s", m, shasum, m.Sha256Sum))
+			continue
+		}
+		modules[archive] = m
+	}
+
+	return modules, merr
+}
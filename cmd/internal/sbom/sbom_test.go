@@ -0,0 +1,138 @@
+package sbom
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/archive"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+var updateGolden = flag.Bool("update", false, "if set, update golden files")
+
+var created = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// buildArchive builds the archive of the testdata/ntp module of the version.
+func buildArchive(t *testing.T, output, version string) domain.Module {
+	t.Helper()
+
+	m := domain.Module{NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: version}}
+	built, err := archive.Build(context.Background(), filepath.Join("testdata", "ntp"), m.NameVersionTuple, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Sha256Sum = built.Sha256Sum
+	return m
+}
+
+// writeChannel writes the channel index listing the modules.
+func writeChannel(t *testing.T, dir string, modules ...domain.Module) config.Channel {
+	t.Helper()
+
+	ch := config.Default().Channels[0]
+	ch.File = filepath.Join(dir, ch.File)
+
+	var idx domain.HostOSConfigurationModules
+	idx.APIVersion = ch.APIVersion
+	idx.Kind = domain.HOCMKind
+	idx.Metadata.Name = ch.ObjectName
+	idx.Spec.Modules = modules
+	if err := index.Write(context.Background(), ch.File, idx); err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestGenerateYanked(t *testing.T) {
+	output := t.TempDir()
+
+	yankedAt := created
+	yanked := buildArchive(t, output, "1.0.0")
+	yanked.YankReason = "CVE-2026-0001"
+	yanked.YankedAt = &yankedAt
+	ch := writeChannel(t, output, yanked, buildArchive(t, output, "1.1.0"))
+
+	t.Run("channel", func(t *testing.T) {
+		written, err := Generate(context.Background(), Config{
+			LogWriter: io.Discard,
+			Channel:   ch,
+			Output:    output,
+			Format:    FormatSPDX,
+			Created:   created,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{filepath.Join(output, "ntp-1.1.0.tgz.spdx.json")}; !slices.Equal(written, want) {
+			t.Errorf("expected %v to be written, got %v", want, written)
+		}
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		written, err := Generate(context.Background(), Config{
+			LogWriter: io.Discard,
+			Channel:   ch,
+			Archives:  []string{filepath.Join(output, yanked.ArchiveName())},
+			Format:    FormatCycloneDX,
+			Created:   created,
+		})
+		if !errors.Is(err, domain.ErrYanked) {
+			t.Fatalf("expected %v, got %v", domain.ErrYanked, err)
+		}
+		if len(written) != 0 {
+			t.Errorf("expected nothing to be written, got %v", written)
+		}
+	})
+}
+
+func TestGenerateGolden(t *testing.T) {
+	for _, format := range []Format{FormatSPDX, FormatCycloneDX} {
+		t.Run(string(format), func(t *testing.T) {
+			output := t.TempDir()
+			ch := writeChannel(t, output, buildArchive(t, output, "1.1.0"))
+
+			written, err := Generate(context.Background(), Config{
+				LogWriter: io.Discard,
+				Channel:   ch,
+				Output:    output,
+				Format:    format,
+				Created:   created,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(written) != 1 {
+				t.Fatalf("expected a single document, got %v", written)
+			}
+
+			got, err := os.ReadFile(written[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "ntp-1.1.0.tgz"+format.Suffix())
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("%s differs from %s, run go test -update to update it:\n%s", written[0], golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+#!/usr/bin/python
+from ansible.module_utils.basic import AnsibleModule
+
+
+def main():
+    module = AnsibleModule(argument_spec=dict(server=dict(type="str", required=True)))
+    module.exit_json(changed=False)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,186 @@
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+type Config struct {
+	LogWriter   io.Writer // logger
+	Dir         string    // directory to create the module in
+	Name        string    // module name
+	Description string    // module description, "<name> module configuration" if empty
+	DocURLBase  string    // URL the module README is published under
+}
+
+var nameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Module creates the module skeleton with the metadata.yaml of the
+// initial version, schema.json, main.yaml and README.md.
+func Module(cfg Config) (string, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	if !nameRe.MatchString(cfg.Name) {
+		return "", fmt.Errorf("malformed module name %q, expected lowercase letters, digits and underscores", cfg.Name)
+	}
+
+	dir := filepath.Join(cfg.Dir, cfg.Name)
+	if _, err := os.Stat(dir); err == nil {
+		return "", fmt.Errorf("module %s already exists in %s", cfg.Name, dir)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to check %s: %w", dir, err)
+	}
+
+	data := struct {
+		Name        string
+		Title       string
+		Description string
+		Version     string
+		DocURL      string
+	}{
+		Name:        cfg.Name,
+		Title:       strings.ReplaceAll(cfg.Name, "_", " "),
+		Description: cfg.Description,
+		Version:     domain.InitialVersion,
+		DocURL:      strings.TrimSuffix(cfg.DocURLBase, "/") + "/" + cfg.Name + "/README.md",
+	}
+	if data.Description == "" {
+		data.Description = data.Title + " module configuration"
+	}
+	if strings.ContainsAny(data.Description, "\r\n") {
+		return "", errors.New("module description must be a single line")
+	}
+
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	for _, f := range []struct {
+		name string
+		tmpl *template.Template
+	}{
+		{"metadata.yaml", metadataTmpl},
+		{"schema.json", schemaTmpl},
+		{"main.yaml", playbookTmpl},
+		{"README.md", readmeTmpl},
+	} {
+		var buf bytes.Buffer
+		if err := f.tmpl.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to render %s: %w", f.name, err)
+		}
+
+		name := filepath.Join(dir, f.name)
+		if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		l.Printf("Created %s", name)
+	}
+
+	return dir, nil
+}
+
+var metadataTmpl = template.Must(template.New("metadata").Funcs(template.FuncMap{
+	"quote": singleQuote,
+}).Parse(`name: {{ .Name }}
+description: {{ quote .Description }}
+version: {{ .Version }}
+valuesJsonSchema: schema.json
+docURL: {{ .DocURL }}
+playbook: main.yaml
+`))
+
+// singleQuote returns the YAML single-quoted scalar of the string,
+// where a single quote is escaped by doubling it.
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+var schemaTmpl = template.Must(template.New("schema").Parse(`{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "disable_reboot_request": {
+      "type": "boolean",
+      "description": "If true, LCM reboot request file creation will be skipped."
+    }
+  }
+}
+`))
+
+var playbookTmpl = template.Must(template.New("playbook").Delims("[[", "]]").Parse(`---
+- name: Configuring [[ .Title ]]
+  hosts: all
+  become: true
+  tasks:
+    - name: Show module values
+      debug:
+        var: values
+
+  handlers:
+    - block:
+      - name: Create /run/day2
+        ansible.builtin.file:
+          path: /run/day2
+          state: directory
+        listen: Create a reboot request
+
+      - name: Update /run/day2/reboot-required with reboot reason
+        ansible.builtin.lineinfile:
+          path: "/run/day2/reboot-required"
+          line: Reboot is requested due to changes introduced by [[ .Name ]] day2 module
+          create: true
+        listen: Create a reboot request
+      when: not ((values.disable_reboot_request | default(False)) | bool)
+`))
+
+var readmeTmpl = template.Must(template.New("readme").Parse(`# {{ .Name }} module
+
+{{ .Description }}.
+
+> Note: This module is implemented and validated against the following Ansible versions provided by MOSK for Ubuntu 20.04, 22.04, 24.04:
+> Ansible core 2.12.10 and Ansible collection 5.10.0.
+>
+> To verify the Ansible version in a specific Cluster release, refer to the
+> **Release artifacts > Management cluster artifacts > System and MCR artifacts**
+> section of the required management Cluster release in
+> [MOSK documentation: Release notes](https://docs.mirantis.com/mosk/latest/release-notes.html).
+
+> Note: To request a reboot, notify the ` + "`Create a reboot request`" + ` handler. The module creates a special file
+> for LCM agent to request a subsequent reboot, unless ` + "`disable_reboot_request`" + ` is set to ` + "`true`" + `.
+
+## Configuration
+
+The module accepts the following values:
+
+- ` + "`disable_reboot_request`" + ` (boolean) - creation of a special file for LCM agent to request
+a subsequent reboot. If ` + "`true`" + `, module does not create such a file and reboot does not occur. Default: ` + "`false`" + `.
+
+## Usage example
+
+` + "```yaml" + `
+apiVersion: kaas.mirantis.com/v1alpha1
+kind: HostOSConfiguration
+metadata:
+  name: {{ .Name }}-example
+  namespace: default
+spec:
+  configs:
+    - module: {{ .Name }}
+      moduleVersion: <version>
+      values:
+        disable_reboot_request: false
+  machineSelector:
+    matchLabels:
+      day2-custom-label: "true"
+` + "```" + `
+`))
@@ -0,0 +1,77 @@
+package scaffold
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestModule(t *testing.T) {
+	for name, tc := range map[string]struct {
+		description string
+		want        string
+	}{
+		"default":      {"", "ntp module configuration"},
+		"plain":        {"Module for NTP configuration", "Module for NTP configuration"},
+		"single quote": {"Module for the host's NTP", "Module for the host's NTP"},
+		"yaml syntax":  {"key: value # not a comment", "key: value # not a comment"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := Module(Config{
+				LogWriter:   io.Discard,
+				Dir:         t.TempDir(),
+				Name:        "ntp",
+				Description: tc.description,
+				DocURLBase:  "https://example.com/modules/",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bb, err := os.ReadFile(filepath.Join(dir, "metadata.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var meta domain.Metadata
+			if err := yaml.Unmarshal(bb, &meta); err != nil {
+				t.Fatalf("malformed metadata.yaml: %v\n%s", err, bb)
+			}
+
+			if meta.Description != tc.want {
+				t.Errorf("description %q, want %q", meta.Description, tc.want)
+			}
+			if meta.Name != "ntp" || meta.Version != domain.InitialVersion || meta.Playbook != "main.yaml" {
+				t.Errorf("unexpected metadata: %+v", meta)
+			}
+			if meta.DocURL != "https://example.com/modules/ntp/README.md" {
+				t.Errorf("docURL %s", meta.DocURL)
+			}
+		})
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{LogWriter: io.Discard, Dir: dir, Name: "ntp"}
+
+	for name, cfg := range map[string]Config{
+		"malformed name":        {LogWriter: io.Discard, Dir: dir, Name: "Ntp-1"},
+		"multiline description": {LogWriter: io.Discard, Dir: dir, Name: "ntp", Description: "first\nsecond"},
+	} {
+		if _, err := Module(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if _, err := Module(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Module(cfg); err == nil {
+		t.Error("existing module: expected error")
+	}
+}
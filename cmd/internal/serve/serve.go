@@ -0,0 +1,208 @@
+package serve
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+)
+
+// AuthEnv is the environment variable with user:password basic authentication credentials.
+const AuthEnv = "MODULE_BUILDER_BASIC_AUTH"
+
+type Config struct {
+	LogWriter io.Writer        // logger
+	Addr      string           // address to listen on
+	Output    string           // where archives are stored
+	Channels  []config.Channel // indexes served if not copied to the output directory
+
+	// Username and Password protect the server with
+	// basic authentication, disabled if both are empty.
+	Username string
+	Password string
+}
+
+// Run serves the output directory over HTTP with the same path
+// layout as the public binary repository until the server fails.
+func Run(cfg Config) error {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           Handler(cfg),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          l,
+	}
+
+	l.Printf("Serving %s on http://%s/%s/", cfg.Output, cfg.Addr, artifact.RepoPath)
+	return srv.ListenAndServe()
+}
+
+// Handler returns the handler serving artifacts of the output directory
+// under the repository path, with ETag and Range requests support.
+func Handler(cfg Config) http.Handler {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	h := &handler{
+		output:  cfg.Output,
+		indexes: map[string]string{},
+		etags:   map[string]etag{},
+	}
+	for _, ch := range cfg.Channels {
+		h.indexes[filepath.Base(ch.File)] = ch.File
+	}
+
+	var next http.Handler = h
+	if cfg.Username != "" || cfg.Password != "" {
+		next = basicAuth(cfg.Username, cfg.Password, next)
+	}
+
+	return logRequests(l, next)
+}
+
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+type handler struct {
+	output  string
+	indexes map[string]string // index base name to its file
+
+	mu    sync.Mutex
+	etags map[string]etag // file to its last known etag
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := strings.CutPrefix(path.Clean(r.URL.Path), "/"+artifact.RepoPath+"/")
+	if !ok || name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	file := filepath.Join(h.output, name)
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		if indexFile, ok := h.indexes[name]; ok {
+			file = indexFile
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+
+	tag, err := h.etag(file, info, f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", tag)
+	if strings.HasSuffix(name, ".yaml") {
+		w.Header().Set("Content-Type", "application/yaml")
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// etag returns the quoted sha256sum of the file, cached until it is modified.
+func (h *handler) etag(file string, info os.FileInfo, f io.ReadSeeker) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.etags[file]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.value, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	value := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	h.etags[file] = etag{modTime: info.ModTime(), size: info.Size(), value: value}
+	return value, nil
+}
+
+func basicAuth(username, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="module-builder"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusWriter records the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func logRequests(l *log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		if rng := r.Header.Get("Range"); rng != "" {
+			l.Printf("%s %s %s (%s) %d %d bytes in %s", r.RemoteAddr, r.Method, r.URL.Path, rng, sw.status, sw.size, time.Since(start))
+			return
+		}
+		l.Printf("%s %s %s %d %d bytes in %s", r.RemoteAddr, r.Method, r.URL.Path, sw.status, sw.size, time.Since(start))
+	})
+}
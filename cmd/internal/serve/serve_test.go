@@ -0,0 +1,230 @@
+package serve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+)
+
+const archive = "ntp 1.0.0 archive"
+
+// newServer serves the output directory with the archive, the dev index
+// served from the working tree and a secret file next to the output.
+// It returns the server and the working tree.
+func newServer(t *testing.T, username, password string) (*httptest.Server, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	output := filepath.Join(root, "artifacts")
+	files := map[string]string{
+		filepath.Join(output, "ntp-1.0.0.tgz"): archive,
+		filepath.Join(output, ".hidden"):       "hidden",
+		filepath.Join(output, "sub", "file"):   "nested",
+		filepath.Join(root, "secret"):          "secret",
+		filepath.Join(root, "index-dev.yaml"):  "spec:\n  modules: []\n",
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	channels := config.Default().Channels
+	for i := range channels {
+		channels[i].File = filepath.Join(root, channels[i].File)
+	}
+
+	srv := httptest.NewServer(Handler(Config{
+		LogWriter: io.Discard,
+		Output:    output,
+		Channels:  channels,
+		Username:  username,
+		Password:  password,
+	}))
+	t.Cleanup(srv.Close)
+	return srv, root
+}
+
+// get requests the path of the server with the headers.
+func get(t *testing.T, srv *httptest.Server, path string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestHandlerETag(t *testing.T) {
+	srv, _ := newServer(t, "", "")
+	path := "/" + artifact.RepoPath + "/ntp-1.0.0.tgz"
+
+	sum := sha256.Sum256([]byte(archive))
+	want := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	resp, body := get(t, srv, path, nil)
+	if resp.StatusCode != http.StatusOK || body != archive {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("ETag"); got != want {
+		t.Fatalf("expected ETag %s, got %s", want, got)
+	}
+
+	resp, body = get(t, srv, path, http.Header{"If-None-Match": {want}})
+	if resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Errorf("expected not modified, got %d %q", resp.StatusCode, body)
+	}
+
+	resp, _ = get(t, srv, path, http.Header{"If-None-Match": {`"stale"`}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the archive for a stale ETag, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerETagModified(t *testing.T) {
+	srv, root := newServer(t, "", "")
+	path := "/" + artifact.RepoPath + "/index-dev.yaml"
+
+	resp, _ := get(t, srv, path, nil)
+	if resp.Header.Get("Content-Type") != "application/yaml" {
+		t.Errorf("unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+	old := resp.Header.Get("ETag")
+
+	// the index of the working tree is rebuilt
+	data := "spec:\n  modules:\n  - name: ntp\n"
+	name := filepath.Join(root, "index-dev.yaml")
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := get(t, srv, path, http.Header{"If-None-Match": {old}})
+	if resp.StatusCode != http.StatusOK || body != data {
+		t.Fatalf("expected the rebuilt index, got %d %q", resp.StatusCode, body)
+	}
+	sum := sha256.Sum256([]byte(data))
+	if want := `"` + hex.EncodeToString(sum[:]) + `"`; resp.Header.Get("ETag") != want {
+		t.Errorf("expected ETag %s, got %s", want, resp.Header.Get("ETag"))
+	}
+}
+
+func TestHandlerRange(t *testing.T) {
+	srv, _ := newServer(t, "", "")
+	path := "/" + artifact.RepoPath + "/ntp-1.0.0.tgz"
+
+	resp, body := get(t, srv, path, http.Header{"Range": {"bytes=4-8"}})
+	if resp.StatusCode != http.StatusPartialContent || body != archive[4:9] {
+		t.Fatalf("unexpected partial response %d %q", resp.StatusCode, body)
+	}
+	if want := "bytes 4-8/17"; resp.Header.Get("Content-Range") != want {
+		t.Errorf("expected Content-Range %s, got %s", want, resp.Header.Get("Content-Range"))
+	}
+
+	resp, _ = get(t, srv, path, http.Header{"Range": {"bytes=100-"}})
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected unsatisfiable range, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlerBasicAuth(t *testing.T) {
+	srv, _ := newServer(t, "user", "secret")
+	path := "/" + artifact.RepoPath + "/ntp-1.0.0.tgz"
+
+	for name, tc := range map[string]struct {
+		username, password string
+		want               int
+	}{
+		"no credentials": {want: http.StatusUnauthorized},
+		"wrong password": {username: "user", password: "wrong", want: http.StatusUnauthorized},
+		"wrong username": {username: "admin", password: "secret", want: http.StatusUnauthorized},
+		"valid":          {username: "user", password: "secret", want: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.username != "" {
+				req.SetBasicAuth(tc.username, tc.password)
+			}
+
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, resp.StatusCode)
+			}
+			if tc.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("authentication challenge is missing")
+			}
+		})
+	}
+}
+
+func TestHandlerNotFound(t *testing.T) {
+	srv, _ := newServer(t, "", "")
+
+	for _, path := range []string{
+		"/" + artifact.RepoPath + "/../secret",
+		"/" + artifact.RepoPath + "/..%2fsecret",
+		"/" + artifact.RepoPath + "/%2e%2e/secret",
+		"/" + artifact.RepoPath + "/sub/file",
+		"/" + artifact.RepoPath + "/.hidden",
+		"/" + artifact.RepoPath + "/",
+		"/" + artifact.RepoPath + "/sub",
+		"/" + artifact.RepoPath + "/index.yaml", // channel is not populated
+		"/secret",
+	} {
+		resp, body := get(t, srv, path, nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected not found, got %d %q", path, resp.StatusCode, body)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/"+artifact.RepoPath+"/ntp-1.0.0.tgz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected method not allowed, got %d", resp.StatusCode)
+	}
+}
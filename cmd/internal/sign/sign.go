@@ -0,0 +1,153 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// KeyEnv is the environment variable with the PEM encoded private key
+	// used when no key file is given.
+	KeyEnv = "MODULE_BUILDER_SIGNING_KEY"
+
+	// Suffix is appended to a file name to get its detached signature.
+	Suffix = ".sig"
+)
+
+// ErrNoKey is returned if neither key file nor environment variable is set.
+var ErrNoKey = errors.New("no signing key")
+
+// ErrMismatch is returned if the signature does not match the file.
+var ErrMismatch = errors.New("signature does not match")
+
+// GenerateKey writes a new ed25519 key pair in PEM format.
+func GenerateKey(privateFile, publicFile string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	if err := os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", privateFile, err)
+	}
+	if err := os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", publicFile, err)
+	}
+
+	return nil
+}
+
+// LoadPrivateKey reads the private key from the file, or from the
+// environment variable if the file name is empty.
+func LoadPrivateKey(name string) (ed25519.PrivateKey, error) {
+	var data []byte
+	if name != "" {
+		bb, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		data = bb
+	} else if env := os.Getenv(KeyEnv); env != "" {
+		name, data = KeyEnv, []byte(env)
+	} else {
+		return nil, ErrNoKey
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", name)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse private key: %w", name, err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 private key", name)
+	}
+
+	return priv, nil
+}
+
+// LoadPublicKey reads the public key from the file.
+func LoadPublicKey(name string) (ed25519.PublicKey, error) {
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	block, _ := pem.Decode(bb)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", name)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse public key: %w", name, err)
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 public key", name)
+	}
+
+	return pub, nil
+}
+
+// File writes the detached signature of the file to sigName,
+// base64 encoded.
+func File(key ed25519.PrivateKey, name, sigName string) error {
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, bb))
+	if err := os.WriteFile(sigName, []byte(sig+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", sigName, err)
+	}
+
+	return nil
+}
+
+// Verify checks the detached signature of the file.
+func Verify(key ed25519.PublicKey, name, sigName string) error {
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	encoded, err := os.ReadFile(sigName)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", sigName, err)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("malformed signature %s: %w", sigName, err)
+	}
+
+	if !ed25519.Verify(key, bb, sig) {
+		return fmt.Errorf("%w: %s of %s", ErrMismatch, sigName, name)
+	}
+
+	return nil
+}
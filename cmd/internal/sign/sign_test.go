@@ -0,0 +1,143 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keyPair generates a key pair in a temporary directory.
+func keyPair(t *testing.T) (ed25519.PrivateKey, ed25519.PublicKey, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	privateFile, publicFile := filepath.Join(dir, "signing.key"), filepath.Join(dir, "signing.pub")
+	if err := GenerateKey(privateFile, publicFile); err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := LoadPrivateKey(privateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := LoadPublicKey(publicFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, pub, privateFile
+}
+
+// signed writes the file and its detached signature.
+func signed(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "index.yaml")
+	if err := os.WriteFile(name, []byte("spec:\n  modules: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := File(key, name, name+Suffix); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestVerify(t *testing.T) {
+	priv, pub, _ := keyPair(t)
+	name := signed(t, priv)
+
+	if err := Verify(pub, name, name+Suffix); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		tamper  func(t *testing.T, name string) ed25519.PublicKey
+		wantIs  error
+		wantErr string
+	}{
+		"tampered file": {
+			tamper: func(t *testing.T, name string) ed25519.PublicKey {
+				if err := os.WriteFile(name, []byte("spec:\n  modules: null\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return nil
+			},
+			wantIs: ErrMismatch,
+		},
+		"wrong key": {
+			tamper: func(t *testing.T, _ string) ed25519.PublicKey {
+				_, pub, _ := keyPair(t)
+				return pub
+			},
+			wantIs: ErrMismatch,
+		},
+		"malformed signature": {
+			tamper: func(t *testing.T, name string) ed25519.PublicKey {
+				if err := os.WriteFile(name+Suffix, []byte("not base64!\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return nil
+			},
+			wantErr: "malformed signature",
+		},
+		"missing signature": {
+			tamper: func(t *testing.T, name string) ed25519.PublicKey {
+				if err := os.Remove(name + Suffix); err != nil {
+					t.Fatal(err)
+				}
+				return nil
+			},
+			wantIs: os.ErrNotExist,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			priv, pub, _ := keyPair(t)
+			name := signed(t, priv)
+			if key := tc.tamper(t, name); key != nil {
+				pub = key
+			}
+
+			err := Verify(pub, name, name+Suffix)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tc.wantIs != nil && !errors.Is(err, tc.wantIs) {
+				t.Errorf("expected %v, got %v", tc.wantIs, err)
+			}
+			if tc.wantErr != "" && !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	_, pub, privateFile := keyPair(t)
+
+	bb, err := os.ReadFile(privateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(KeyEnv, string(bb))
+
+	priv, err := LoadPrivateKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(priv.Public()) {
+		t.Error("private key of the environment variable does not match the public key")
+	}
+
+	t.Setenv(KeyEnv, "")
+	if _, err := LoadPrivateKey(""); !errors.Is(err, ErrNoKey) {
+		t.Errorf("expected %v, got %v", ErrNoKey, err)
+	}
+
+	if _, err := LoadPrivateKey(filepath.Join(filepath.Dir(privateFile), "signing.pub")); err == nil {
+		t.Error("expected error loading the public key as a private one")
+	}
+}
@@ -1,6 +1,8 @@
 package sort
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,35 +11,96 @@ import (
 	"slices"
 	"strings"
 
-	"module-builder/internal/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
 
+	"github.com/Masterminds/semver/v3"
 	"gopkg.in/yaml.v3"
 )
 
+// ErrUnsorted is returned in the check mode if an index is not sorted.
+var ErrUnsorted = errors.New("index is not sorted")
+
 type Config struct {
 	LogWriter io.Writer // logger
+	Check     bool      // verify order without rewriting indexes
+	Files     []string  // index files, index.yaml and index-dev.yaml if empty
+}
+
+// Result lists index files processed by Index.
+type Result struct {
+	Files   []string `json:"files"`   // checked or sorted files
+	Changed []string `json:"changed"` // files rewritten with a different order
 }
 
 // Index sorts index.yaml by name and version (if names are equal).
-func Index(cfg Config) error {
+func Index(cfg Config) (Result, error) {
+	res := Result{Files: []string{}, Changed: []string{}}
 	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
-	for _, indexFile := range [2]string{domain.ReleaseIndexFileName, domain.DevIndexFileName} {
+	if len(cfg.Files) == 0 {
+		cfg.Files = []string{domain.ReleaseIndexFileName, domain.DevIndexFileName}
+	}
+
+	for _, indexFile := range cfg.Files {
 		absIndexFile, err := filepath.Abs(indexFile)
 		if err != nil {
-			return fmt.Errorf("failed to determine abs path for the %s: %w", indexFile, err)
+			return res, fmt.Errorf("failed to determine abs path for the %s: %w", indexFile, err)
+		}
+
+		if cfg.Check {
+			l.Printf("Checking modules order in the %s file", absIndexFile)
+			if err := check(l, absIndexFile); err != nil {
+				l.Printf("Error during checking %s: %v", absIndexFile, err)
+				return res, fmt.Errorf("check failed: %w", err)
+			}
+			res.Files = append(res.Files, absIndexFile)
+			continue
 		}
 
+		before, _ := os.ReadFile(absIndexFile) // missing files are created
 		l.Printf("Sorting modules in the %s file", absIndexFile)
-		if err := index(absIndexFile); err != nil {
+		if err := index(l, absIndexFile); err != nil {
 			l.Printf("Error during sorting %s: %v", absIndexFile, err)
-			return fmt.Errorf("sorting failed: %w", err)
+			return res, fmt.Errorf("sorting failed: %w", err)
+		}
+		res.Files = append(res.Files, absIndexFile)
+
+		after, err := os.ReadFile(absIndexFile)
+		if err != nil {
+			return res, fmt.Errorf("failed to read %s: %w", absIndexFile, err)
+		}
+		if !bytes.Equal(before, after) {
+			res.Changed = append(res.Changed, absIndexFile)
 		}
 	}
 
+	return res, nil
+}
+
+func check(l *log.Logger, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	var index domain.HostOSConfigurationModules
+	if err := yaml.NewDecoder(f).Decode(&index); err != nil {
+		return fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+	}
+
+	normalized, err := normalize(l, index.Spec.Modules)
+	if err != nil {
+		return err
+	}
+
+	if len(normalized) != len(index.Spec.Modules) || !slices.IsSortedFunc(index.Spec.Modules, cmpModule) {
+		return fmt.Errorf("%s: %w", name, ErrUnsorted)
+	}
+
 	return nil
 }
 
-func index(name string) error {
+func index(l *log.Logger, name string) error {
 	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
@@ -49,6 +112,11 @@ func index(name string) error {
 		return fmt.Errorf("failed to deserialize data from %s: %w", name, err)
 	}
 
+	index.Spec.Modules, err = normalize(l, index.Spec.Modules)
+	if err != nil {
+		return err
+	}
+
 	if err := f.Truncate(0); err != nil {
 		return fmt.Errorf("failed to truncate %s: %w", f.Name(), err)
 	}
@@ -57,7 +125,7 @@ func index(name string) error {
 		return fmt.Errorf("failed to set the offset in %s: %w", f.Name(), err)
 	}
 
-	slices.SortStableFunc(index.Spec.Modules, cmpModule)
+	Modules(index.Spec.Modules)
 
 	enc := yaml.NewEncoder(f)
 	enc.SetIndent(2)
@@ -68,9 +136,45 @@ func index(name string) error {
 	return enc.Close()
 }
 
+// normalize drops exact duplicates from modules and reports entries
+// which can not be kept in the index: malformed semver versions and
+// duplicates with a different sha256sum.
+func normalize(l *log.Logger, modules []domain.Module) ([]domain.Module, error) {
+	var (
+		merr   error
+		result = make([]domain.Module, 0, len(modules))
+		seen   = make(map[domain.NameVersionTuple]domain.Module, len(modules))
+	)
+	for _, m := range modules {
+		if _, err := semver.StrictNewVersion(m.Version); err != nil {
+			merr = errors.Join(merr, fmt.Errorf("module %s has invalid semver version: %w", m, err))
+			continue
+		}
+
+		prev, exists := seen[m.NameVersionTuple]
+		switch {
+		case !exists:
+			seen[m.NameVersionTuple] = m
+			result = append(result, m)
+		case prev.IsEqual(m):
+			l.Printf("Dropping duplicate entry of the module %s", m)
+		default:
+			merr = errors.Join(merr, fmt.Errorf("module %s is duplicated with different sha256sums %s and %s",
+				m, prev.Sha256Sum, m.Sha256Sum))
+		}
+	}
+
+	return slices.Clip(result), merr
+}
+
+// Modules sorts modules by name and semver precedence of versions.
+func Modules(modules []domain.Module) {
+	slices.SortStableFunc(modules, cmpModule)
+}
+
 func cmpModule(a, b domain.Module) int {
 	if a.Name == b.Name {
-		return strings.Compare(a.Version, b.Version)
+		return cmpVersion(a.Version, b.Version)
 	}
 
 	if a.Name < b.Name {
@@ -79,3 +183,23 @@ func cmpModule(a, b domain.Module) int {
 
 	return +1
 }
+
+// cmpVersion compares versions by semver precedence,
+// malformed versions are ordered lexically after valid ones.
+func cmpVersion(a, b string) int {
+	av, aErr := semver.NewVersion(a)
+	bv, bErr := semver.NewVersion(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		if c := av.Compare(bv); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return +1
+	default:
+		return strings.Compare(a, b)
+	}
+}
@@ -0,0 +1,231 @@
+package sort
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+func module(name, version string) domain.Module {
+	return domain.Module{
+		NameVersionTuple: domain.NameVersionTuple{Name: name, Version: version},
+		Sha256Sum:        name + "-" + version,
+	}
+}
+
+func names(modules []domain.Module) []string {
+	s := make([]string, 0, len(modules))
+	for _, m := range modules {
+		s = append(s, m.String())
+	}
+	return s
+}
+
+// writeIndex writes the index file with modules in the given order.
+func writeIndex(t *testing.T, modules ...domain.Module) string {
+	t.Helper()
+
+	var idx domain.HostOSConfigurationModules
+	idx.APIVersion = domain.HOCMAPIVersion
+	idx.Kind = domain.HOCMKind
+	idx.Metadata.Name = domain.ReleaseHOCMObjName
+	idx.Spec.Modules = modules
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(&idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), domain.ReleaseIndexFileName)
+	if err := os.WriteFile(name, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// readModules returns modules of the index file.
+func readModules(t *testing.T, name string) []domain.Module {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx domain.HostOSConfigurationModules
+	if err := yaml.Unmarshal(data, &idx); err != nil {
+		t.Fatal(err)
+	}
+	return idx.Spec.Modules
+}
+
+func TestModules(t *testing.T) {
+	modules := []domain.Module{
+		module("sysctl", "1.0.0"),
+		module("ntp", "1.10.0"),
+		module("ntp", "1.0.0"),
+		module("ntp", "1.0.0-rc.1"),
+		module("ntp", "1.0.1-dev"),
+		module("ntp", "1.0.0-dev"),
+		module("ntp", "1.0.0-rc.10"),
+		module("ntp", "1.0.0-rc.2"),
+		module("auditd", "2.0.0"),
+	}
+
+	Modules(modules)
+
+	want := []string{
+		"auditd-2.0.0",
+		"ntp-1.0.0-dev",
+		"ntp-1.0.0-rc.1",
+		"ntp-1.0.0-rc.2",
+		"ntp-1.0.0-rc.10",
+		"ntp-1.0.0",
+		"ntp-1.0.1-dev",
+		"ntp-1.10.0",
+		"sysctl-1.0.0",
+	}
+	if got := names(modules); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	sorted := []domain.Module{module("ntp", "1.0.0-dev"), module("ntp", "1.0.0"), module("sysctl", "1.0.0")}
+
+	for name, tc := range map[string]struct {
+		modules     []domain.Module
+		want        []string
+		wantChanged bool
+	}{
+		"sorted": {
+			modules: sorted,
+			want:    names(sorted),
+		},
+		"unsorted": {
+			modules:     []domain.Module{module("sysctl", "1.0.0"), module("ntp", "1.0.0"), module("ntp", "1.0.0-dev")},
+			want:        names(sorted),
+			wantChanged: true,
+		},
+		"exact duplicate": {
+			modules:     []domain.Module{module("ntp", "1.0.0-dev"), module("ntp", "1.0.0"), module("ntp", "1.0.0"), module("sysctl", "1.0.0")},
+			want:        names(sorted),
+			wantChanged: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := writeIndex(t, tc.modules...)
+
+			res, err := Index(Config{LogWriter: io.Discard, Files: []string{file}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(res.Files, []string{file}) {
+				t.Errorf("expected files %v, got %v", []string{file}, res.Files)
+			}
+			if changed := slices.Contains(res.Changed, file); changed != tc.wantChanged {
+				t.Errorf("expected changed %t, got %v", tc.wantChanged, res.Changed)
+			}
+
+			if got := names(readModules(t, file)); !slices.Equal(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIndexCheck(t *testing.T) {
+	for name, tc := range map[string]struct {
+		modules []domain.Module
+		wantErr error
+	}{
+		"sorted": {
+			modules: []domain.Module{module("ntp", "1.0.0-dev"), module("ntp", "1.0.0"), module("sysctl", "1.0.0")},
+		},
+		"unsorted": {
+			modules: []domain.Module{module("ntp", "1.0.0"), module("ntp", "1.0.0-dev")},
+			wantErr: ErrUnsorted,
+		},
+		"exact duplicate": {
+			modules: []domain.Module{module("ntp", "1.0.0"), module("ntp", "1.0.0")},
+			wantErr: ErrUnsorted,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := writeIndex(t, tc.modules...)
+			before, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = Index(Config{LogWriter: io.Discard, Check: true, Files: []string{file}})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+
+			after, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(before) != string(after) {
+				t.Errorf("checked index is modified:\n%s", after)
+			}
+		})
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	conflicting := module("ntp", "1.0.0")
+	conflicting.Sha256Sum = "other"
+
+	for name, tc := range map[string]struct {
+		modules []domain.Module
+		wantErr string
+	}{
+		"invalid semver": {
+			modules: []domain.Module{module("ntp", "1.0"), module("sysctl", "1.0.0")},
+			wantErr: "module ntp-1.0 has invalid semver version",
+		},
+		"duplicate with a different sha256sum": {
+			modules: []domain.Module{module("ntp", "1.0.0"), conflicting},
+			wantErr: "module ntp-1.0.0 is duplicated with different sha256sums ntp-1.0.0 and other",
+		},
+	} {
+		for _, check := range []bool{false, true} {
+			t.Run(name, func(t *testing.T) {
+				file := writeIndex(t, tc.modules...)
+				before, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = Index(Config{LogWriter: io.Discard, Check: check, Files: []string{file}})
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("check %t: expected error containing %q, got %v", check, tc.wantErr, err)
+				}
+				if errors.Is(err, ErrUnsorted) {
+					t.Errorf("check %t: unexpected %v", check, ErrUnsorted)
+				}
+
+				after, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(before) != string(after) {
+					t.Errorf("check %t: index is modified:\n%s", check, after)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	LogWriter io.Writer        // logger
+	Dir       string           // git working tree relative paths are resolved in, the current directory if empty
+	Dirs      []string         // module directories
+	Channels  []config.Channel // channels with release and dev entries
+}
+
+// Module is the state of a single module.
+type Module struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`           // metadata.yaml version
+	Release string `json:"release,omitempty"` // latest version in release channels
+	Dev     string `json:"dev,omitempty"`     // latest version in dev channels
+
+	// Changed reports uncommitted changes in the working tree.
+	Changed bool `json:"changed"`
+
+	// Yanked reports that the metadata.yaml version is withdrawn
+	// in a channel and has to be bumped by the next release.
+	Yanked bool `json:"yanked,omitempty"`
+
+	// ReleaseCommit is the last commit with the released metadata.yaml
+	// version and CommitsSinceRelease counts later commits changing the module.
+	ReleaseCommit       string `json:"releaseCommit,omitempty"`
+	CommitsSinceRelease int    `json:"commitsSinceRelease"`
+}
+
+// Unreleased reports whether the module has changes not promoted yet.
+func (m Module) Unreleased() bool {
+	return m.Changed || m.Yanked || m.CommitsSinceRelease > 0 || m.Version != m.Release
+}
+
+// Modules collects the state of every module directory.
+func Modules(ctx context.Context, cfg Config) ([]Module, error) {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+
+	latest := map[config.Stage]map[string]*semver.Version{
+		config.StageRelease: {},
+		config.StageDev:     {},
+	}
+	yanked := map[domain.NameVersionTuple]bool{}
+	for _, ch := range cfg.Channels {
+		file := resolve(cfg.Dir, ch.File)
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			continue // channel is not populated yet
+		}
+
+		idx, err := index.Read(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range idx.Spec.Modules {
+			if m.IsYanked() {
+				yanked[m.NameVersionTuple] = true
+				continue
+			}
+			v, err := semver.NewVersion(m.Version)
+			if err != nil {
+				l.Printf("WARNING: skipping module %s of the %s channel with malformed version: %v", m, ch.Name, err)
+				continue
+			}
+			if cur, ok := latest[ch.Stage][m.Name]; !ok || v.GreaterThan(cur) {
+				latest[ch.Stage][m.Name] = v
+			}
+		}
+	}
+
+	changed, err := module.Changes(cfg.Dir, cfg.Dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make([]Module, 0, len(cfg.Dirs))
+	for _, dir := range cfg.Dirs {
+		meta, err := readMetadata(resolve(cfg.Dir, dir))
+		if err != nil {
+			return nil, err
+		}
+
+		m := Module{
+			Name:    meta.Name,
+			Version: meta.Version,
+			Changed: changed[filepath.Base(filepath.Clean(dir))],
+			Yanked:  yanked[meta.NameVersionTuple],
+		}
+		if v, ok := latest[config.StageRelease][meta.Name]; ok {
+			m.Release = v.Original()
+		}
+		if v, ok := latest[config.StageDev][meta.Name]; ok {
+			m.Dev = v.Original()
+		}
+
+		m.ReleaseCommit, m.CommitsSinceRelease, err = commitsSinceRelease(cfg.Dir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", meta.Name, err)
+		}
+
+		modules = append(modules, m)
+	}
+
+	return modules, nil
+}
+
+// resolve returns the path, relative ones are resolved in the working tree dir.
+func resolve(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
+
+func readMetadata(dir string) (domain.Metadata, error) {
+	var meta domain.Metadata
+
+	name := filepath.Join(dir, "metadata.yaml")
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return meta, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := yaml.Unmarshal(bb, &meta); err != nil {
+		return meta, fmt.Errorf("failed to deserialize yaml %s: %w", name, err)
+	}
+
+	return meta, nil
+}
+
+// commitsSinceRelease finds the last commit with the released version
+// in the module metadata.yaml and counts later commits changing the module,
+// git runs in the worktree the module dir is relative to.
+func commitsSinceRelease(worktree, dir string) (string, int, error) {
+	metaFile := filepath.Join(dir, "metadata.yaml")
+
+	commits, err := git.Run(worktree, "log", "--format=%H", "--", metaFile)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var release string
+	for _, commit := range strings.Fields(commits) {
+		// git show requires paths relative to the current directory to be prefixed
+		bb, err := git.Run(worktree, "show", commit+":./"+filepath.ToSlash(metaFile))
+		if err != nil {
+			continue // the module is moved
+		}
+
+		var meta domain.NameVersionTuple
+		if err := yaml.Unmarshal([]byte(bb), &meta); err != nil {
+			continue
+		}
+		if v, err := semver.NewVersion(meta.Version); err == nil && v.Prerelease() == "" && meta.Version != domain.InitialVersion {
+			release = commit
+			break
+		}
+	}
+
+	revs := "HEAD"
+	if release != "" {
+		revs = release + "..HEAD"
+	}
+	count, err := git.Run(worktree, "rev-list", "--count", revs, "--", dir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed commit count %q: %w", count, err)
+	}
+
+	return release, n, nil
+}
+
+// WriteTable writes modules as an aligned table.
+func WriteTable(w io.Writer, modules []Module) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tVERSION\tRELEASE\tDEV\tCHANGED\tCOMMITS SINCE RELEASE")
+	for _, m := range modules {
+		changed := "no"
+		if m.Changed {
+			changed = "yes"
+		}
+		version := m.Version
+		if m.Yanked {
+			version += " (yanked)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", m.Name, version, orDash(m.Release), orDash(m.Dev), changed, m.CommitsSinceRelease)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package status
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/git/gittest"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+)
+
+func metadata(name, version string) string {
+	return "name: " + name + "\nversion: " + version + "\nplaybook: main.yaml\n"
+}
+
+// entry returns the index entry of the module version.
+func entry(name, version string) domain.Module {
+	return domain.Module{
+		NameVersionTuple: domain.NameVersionTuple{Name: name, Version: version},
+		Sha256Sum:        name + "-" + version,
+	}
+}
+
+func TestModules(t *testing.T) {
+	repo := gittest.New(t, map[string]string{
+		"ntp/metadata.yaml":    metadata("ntp", "1.0.0"),
+		"ntp/main.yaml":        "---\n",
+		"sysctl/metadata.yaml": metadata("sysctl", "1.0.0-dev"),
+		"sysctl/main.yaml":     "---\n",
+		"auditd/metadata.yaml": metadata("auditd", "2.0.0"),
+		"auditd/main.yaml":     "---\n",
+	})
+	release := gittest.Run(t, repo, "rev-parse", "HEAD")
+
+	// ntp is changed and bumped after the release
+	gittest.Write(t, repo, map[string]string{"ntp/main.yaml": "- hosts: all\n"})
+	gittest.Commit(t, repo, "change ntp")
+	gittest.Write(t, repo, map[string]string{"ntp/metadata.yaml": metadata("ntp", "1.0.1-dev")})
+	gittest.Commit(t, repo, "bump ntp")
+
+	// sysctl is changed in the working tree
+	gittest.Write(t, repo, map[string]string{"sysctl/main.yaml": "- hosts: all\n"})
+
+	yankedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	yanked := entry("auditd", "2.0.0")
+	yanked.YankReason = "CVE-2026-0001"
+	yanked.YankedAt = &yankedAt
+
+	channels := config.Default().Channels
+	for i, modules := range [][]domain.Module{
+		{entry("auditd", "1.0.0"), yanked, entry("ntp", "1.0.0")},
+		{entry("ntp", "1.0.1-dev"), entry("sysctl", "1.0.0-dev")},
+	} {
+		channels[i].File = filepath.Join(repo, channels[i].File)
+		if err := index.Write(context.Background(), channels[i].File, index.New("", channels[i].ObjectName, modules)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Modules(context.Background(), Config{
+		LogWriter: io.Discard,
+		Dir:       repo,
+		Dirs:      []string{"auditd", "ntp", "sysctl"},
+		Channels:  channels,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Module{
+		{Name: "auditd", Version: "2.0.0", Release: "1.0.0", Yanked: true, ReleaseCommit: release},
+		{Name: "ntp", Version: "1.0.1-dev", Release: "1.0.0", Dev: "1.0.1-dev", ReleaseCommit: release, CommitsSinceRelease: 2},
+		{Name: "sysctl", Version: "1.0.0-dev", Dev: "1.0.0-dev", Changed: true, CommitsSinceRelease: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	for _, m := range got {
+		if !m.Unreleased() {
+			t.Errorf("module %s: expected unreleased", m.Name)
+		}
+	}
+	if released := (Module{Name: "ntp", Version: "1.0.0", Release: "1.0.0", ReleaseCommit: release}); released.Unreleased() {
+		t.Error("released module is reported as unreleased")
+	}
+
+	var b strings.Builder
+	if err := WriteTable(&b, got); err != nil {
+		t.Fatal(err)
+	}
+	wantTable := `MODULE  VERSION         RELEASE  DEV        CHANGED  COMMITS SINCE RELEASE
+auditd  2.0.0 (yanked)  1.0.0    -          no       0
+ntp     1.0.1-dev       1.0.0    1.0.1-dev  no       2
+sysctl  1.0.0-dev       -        1.0.0-dev  yes      1
+`
+	if b.String() != wantTable {
+		t.Errorf("unexpected table:\n%s", &b)
+	}
+}
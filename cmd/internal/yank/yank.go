@@ -0,0 +1,145 @@
+package yank
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	LogWriter io.Writer // logger
+	Dir       string    // module path (either abs or rel)
+	Version   string    // version to withdraw
+	Reason    string    // why the version is withdrawn
+	IndexFile string    // release index file, index.yaml if empty
+}
+
+// Module marks the module version in the index.yaml as withdrawn
+// and deprecates it in the module metadata.yaml.
+func Module(ctx context.Context, cfg Config) error {
+	l := log.New(cfg.LogWriter, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+	if cfg.IndexFile == "" {
+		cfg.IndexFile = domain.ReleaseIndexFileName
+	}
+
+	if cfg.Reason == "" {
+		return fmt.Errorf("reason is required to yank a module")
+	}
+
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to determine abs path for the %s: %w", cfg.Dir, err)
+	}
+
+	releaseIndexAbsPath, err := filepath.Abs(cfg.IndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to determine abs path for the %s: %w", cfg.IndexFile, err)
+	}
+
+	tuple := domain.NameVersionTuple{Name: filepath.Base(dir), Version: cfg.Version}
+
+	releaseIndex, err := index.Read(ctx, releaseIndexAbsPath)
+	if err != nil {
+		return err
+	}
+
+	idx := releaseIndex.Find(tuple)
+	if idx < 0 {
+		return fmt.Errorf("module %s is not released", tuple)
+	}
+
+	if m := &releaseIndex.Spec.Modules[idx]; m.IsYanked() {
+		l.Printf("Module %s is already yanked at %s: %s", tuple, m.YankedAt.Format(time.RFC3339), m.YankReason)
+	} else {
+		l.Printf("Yanking module %s from the %s", tuple, releaseIndexAbsPath)
+		m.YankReason = cfg.Reason
+		yankedAt := time.Now().UTC().Truncate(time.Second)
+		m.YankedAt = &yankedAt
+
+		if err := index.Write(ctx, releaseIndexAbsPath, releaseIndex); err != nil {
+			return fmt.Errorf("failed to update release index: %w", err)
+		}
+	}
+
+	metaFileName := filepath.Join(dir, "metadata.yaml")
+	l.Printf("Deprecating version %s in the %s", cfg.Version, metaFileName)
+	if err := deprecateVersion(metaFileName, cfg.Version); err != nil {
+		return fmt.Errorf("failed to deprecate version in %s: %w", metaFileName, err)
+	}
+
+	return nil
+}
+
+// deprecateVersion adds the version to the deprecates list
+// of the metadata.yaml keeping the rest of the document intact.
+func deprecateVersion(name, version string) error {
+	bb, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(bb, &doc); err != nil {
+		return fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a mapping", name)
+	}
+
+	root := doc.Content[0]
+	var deprecates *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "deprecates" {
+			deprecates = root.Content[i+1]
+			break
+		}
+	}
+
+	switch {
+	case deprecates == nil:
+		deprecates = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "deprecates"}, deprecates)
+	case deprecates.Tag == "!!null":
+		*deprecates = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	case deprecates.Kind != yaml.SequenceNode:
+		return fmt.Errorf("%s: deprecates must be a list", name)
+	}
+
+	var existing []domain.Deprecation
+	if err := deprecates.Decode(&existing); err != nil {
+		return fmt.Errorf("%s: malformed deprecates: %w", name, err)
+	}
+	if slices.Contains(existing, domain.Deprecation{Version: version}) {
+		return nil // already deprecated
+	}
+
+	var entry yaml.Node
+	if err := entry.Encode(domain.Deprecation{Version: version}); err != nil {
+		return fmt.Errorf("failed to serialize deprecation: %w", err)
+	}
+	deprecates.Style = 0 // block style, e.g. for the empty flow sequence
+	deprecates.Content = append(deprecates.Content, &entry)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to serialize data to the %s: %w", name, err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to serialize data to the %s: %w", name, err)
+	}
+
+	return os.WriteFile(name, buf.Bytes(), 0o644)
+}
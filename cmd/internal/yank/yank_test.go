@@ -0,0 +1,108 @@
+package yank
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+
+	"gopkg.in/yaml.v3"
+)
+
+const metadata = `name: ntp
+description: 'Module for NTP configuration'
+version: 1.1.0
+valuesJsonSchema: schema.json
+docURL: https://example.com/ntp/README.md
+playbook: main.yaml
+`
+
+func TestDeprecateVersion(t *testing.T) {
+	for name, tc := range map[string]struct {
+		deprecates string
+		want       []string
+	}{
+		"missing":       {"", []string{"1.0.0"}},
+		"null":          {"deprecates:\n", []string{"1.0.0"}},
+		"empty flow":    {"deprecates: []\n", []string{"1.0.0"}},
+		"indented":      {"deprecates:\n  - version: 0.9.0\n", []string{"0.9.0", "1.0.0"}},
+		"zero indented": {"deprecates:\n- version: 0.9.0\n", []string{"0.9.0", "1.0.0"}},
+		"duplicated":    {"deprecates:\n- version: 1.0.0\n", []string{"1.0.0"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "metadata.yaml")
+			if err := os.WriteFile(file, []byte(metadata+tc.deprecates), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := deprecateVersion(file, "1.0.0"); err != nil {
+				t.Fatal(err)
+			}
+
+			bb, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var meta domain.Metadata
+			if err := yaml.Unmarshal(bb, &meta); err != nil {
+				t.Fatalf("malformed metadata.yaml: %v\n%s", err, bb)
+			}
+
+			var got []string
+			for _, d := range meta.Deprecates {
+				got = append(got, d.Version)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("deprecates %v, want %v", got, tc.want)
+			}
+			if meta.Description != "Module for NTP configuration" || meta.Version != "1.1.0" || meta.Playbook != "main.yaml" {
+				t.Errorf("metadata is changed: %+v", meta)
+			}
+		})
+	}
+}
+
+func TestModule(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "ntp")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte(metadata), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexFile := filepath.Join(root, domain.ReleaseIndexFileName)
+	m := domain.Module{NameVersionTuple: domain.NameVersionTuple{Name: "ntp", Version: "1.0.0"}, Sha256Sum: "abc"}
+	if err := index.Write(context.Background(), indexFile, index.New("", domain.ReleaseHOCMObjName, []domain.Module{m})); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{LogWriter: io.Discard, Dir: dir, Version: "1.0.0", IndexFile: indexFile}
+	if err := Module(context.Background(), cfg); err == nil {
+		t.Error("module is yanked without a reason")
+	}
+
+	cfg.Reason = "broken chrony config"
+	if err := Module(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := index.Read(context.Background(), indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.Spec.Modules[0]; !got.IsYanked() || got.YankReason != cfg.Reason {
+		t.Errorf("module is not yanked: %+v", got)
+	}
+
+	cfg.Version = "2.0.0"
+	if err := Module(context.Background(), cfg); err == nil {
+		t.Error("not released module is yanked")
+	}
+}
@@ -3,14 +3,49 @@ package main
 //go:generate go test -run=TestDocHelp -update
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"strings"
 
-	"module-builder/internal/module"
-	"module-builder/internal/sort"
+	"github.com/Mirantis/host-os-modules/cmd/internal/apply"
+	"github.com/Mirantis/host-os-modules/cmd/internal/artifact"
+	"github.com/Mirantis/host-os-modules/cmd/internal/bundle"
+	"github.com/Mirantis/host-os-modules/cmd/internal/check"
+	"github.com/Mirantis/host-os-modules/cmd/internal/config"
+	"github.com/Mirantis/host-os-modules/cmd/internal/indexdiff"
+	"github.com/Mirantis/host-os-modules/cmd/internal/manifests"
+	"github.com/Mirantis/host-os-modules/cmd/internal/merge"
+	"github.com/Mirantis/host-os-modules/cmd/internal/mirror"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/internal/oci"
+	"github.com/Mirantis/host-os-modules/cmd/internal/provenance"
+	"github.com/Mirantis/host-os-modules/cmd/internal/prune"
+	"github.com/Mirantis/host-os-modules/cmd/internal/publish"
+	"github.com/Mirantis/host-os-modules/cmd/internal/release"
+	"github.com/Mirantis/host-os-modules/cmd/internal/resolve"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sbom"
+	"github.com/Mirantis/host-os-modules/cmd/internal/scaffold"
+	"github.com/Mirantis/host-os-modules/cmd/internal/serve"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sign"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sort"
+	"github.com/Mirantis/host-os-modules/cmd/internal/status"
+	"github.com/Mirantis/host-os-modules/cmd/internal/yank"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/index"
+	moduleversion "github.com/Mirantis/host-os-modules/cmd/pkg/version"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 type command struct {
@@ -20,6 +55,11 @@ type command struct {
 	short   string
 	long    string
 	hasArgs bool
+
+	// interspersed allows flags after arguments, e.g. refs of index-diff,
+	// otherwise parsing stops at the first argument as usual, hence
+	// module directories and other arguments may start with a dash.
+	interspersed bool
 }
 
 func (c command) name() string {
@@ -28,11 +68,72 @@ func (c command) name() string {
 }
 
 var (
-	moduleFlags = flag.NewFlagSet("module", flag.ExitOnError)
-	cleanFlags  = flag.NewFlagSet("clean", flag.ExitOnError)
+	moduleFlags     = flag.NewFlagSet("module", flag.ExitOnError)
+	cleanFlags      = flag.NewFlagSet("clean", flag.ExitOnError)
+	sortFlags       = flag.NewFlagSet("sort", flag.ExitOnError)
+	yankFlags       = flag.NewFlagSet("yank", flag.ExitOnError)
+	pruneFlags      = flag.NewFlagSet("prune", flag.ExitOnError)
+	diffFlags       = flag.NewFlagSet("index-diff", flag.ExitOnError)
+	mergeFlags      = flag.NewFlagSet("index-merge", flag.ExitOnError)
+	resolveFlags    = flag.NewFlagSet("resolve", flag.ExitOnError)
+	bundleFlags     = flag.NewFlagSet("bundle", flag.ExitOnError)
+	unbundleFlags   = flag.NewFlagSet("unbundle", flag.ExitOnError)
+	keygenFlags     = flag.NewFlagSet("keygen", flag.ExitOnError)
+	verifySigFlags  = flag.NewFlagSet("verify-signature", flag.ExitOnError)
+	verifyProvFlags = flag.NewFlagSet("verify-provenance", flag.ExitOnError)
+	sbomFlags       = flag.NewFlagSet("sbom", flag.ExitOnError)
+	serveFlags      = flag.NewFlagSet("serve", flag.ExitOnError)
+	mirrorFlags     = flag.NewFlagSet("mirror", flag.ExitOnError)
+	publishFlags    = flag.NewFlagSet("publish", flag.ExitOnError)
+	ociPushFlags    = flag.NewFlagSet("oci-push", flag.ExitOnError)
+	ociPullFlags    = flag.NewFlagSet("oci-pull", flag.ExitOnError)
+	manifestsFlags  = flag.NewFlagSet("manifests", flag.ExitOnError)
+	applyFlags      = flag.NewFlagSet("apply", flag.ExitOnError)
+	newFlags        = flag.NewFlagSet("new", flag.ExitOnError)
+	statusFlags     = flag.NewFlagSet("status", flag.ExitOnError)
+	releaseFlags    = flag.NewFlagSet("release", flag.ExitOnError)
+	checkFlags      = flag.NewFlagSet("check", flag.ExitOnError)
 
-	outputDir   string
-	promoteType = module.PromoteNone
+	configFile     string
+	outputDir      string
+	promoteType    = moduleversion.PromoteNone
+	replaceReason  string
+	sortCheck      bool
+	yankReason     string
+	pruneCfg       prune.Config
+	yankChannel    string
+	pruneChannel   string
+	mergeCfg       merge.Config
+	resolveDev     bool
+	bundleChannel  string
+	bundleCfg      bundle.Config
+	unbundleCfg    bundle.ExtractConfig
+	signingKey     string
+	privateKey     string
+	publicKey      string
+	withProvenance bool
+	sbomChannel    string
+	sbomFormat     string
+	sbomCfg        sbom.Config
+	serveCfg       serve.Config
+	serveAuth      string
+	mirrorCfg      mirror.Config
+	publishCfg     publish.Config
+	publishChans   []string
+	ociChannel     string
+	ociPushCfg     oci.PushConfig
+	ociPullCfg     oci.PullConfig
+	manifestsCfg   manifests.Config
+	manifestsChan  []string
+	applyCfg       apply.Config
+	applyChannel   string
+	applyDryRun    string
+	kubeconfig     string
+	kubeContext    string
+	scaffoldCfg    scaffold.Config
+	releaseCfg     release.Config
+	checkCfg       check.Config
+	unreleased     bool
 
 	commands = []*command{
 		{
@@ -44,20 +145,477 @@ var (
 			hasArgs: true,
 		},
 		{
-			usage: "sort",
+			usage: "sort [flags]",
 			short: "sorts index-dev.yaml and index.yaml",
 			long:  ``, // TODO
+			flags: sortFlags,
 			run:   runSort,
 		},
+		{
+			usage:   "yank <module>@<version> [flags]",
+			short:   "withdraw a released module version",
+			long:    yankLong,
+			flags:   yankFlags,
+			run:     runYank,
+			hasArgs: true,
+		},
+		{
+			usage: "prune [flags]",
+			short: "remove old module versions from the index.yaml and output directory",
+			long:  pruneLong,
+			flags: pruneFlags,
+			run:   runPrune,
+		},
+		{
+			usage:        "index-diff [<refA>] [<refB>] [flags]",
+			short:        "compare indexes between files or git revisions",
+			long:         indexDiffLong,
+			flags:        diffFlags,
+			run:          runIndexDiff,
+			hasArgs:      true,
+			interspersed: true,
+		},
+		{
+			usage:   "index-merge [namespace=]<file>... [flags]",
+			short:   "merge several indexes into a single one",
+			long:    indexMergeLong,
+			flags:   mergeFlags,
+			run:     runIndexMerge,
+			hasArgs: true,
+		},
+		{
+			usage:   "resolve <module> <constraint> [flags]",
+			short:   "find the newest module version satisfying a semver constraint",
+			long:    resolveLong,
+			flags:   resolveFlags,
+			run:     runResolve,
+			hasArgs: true,
+		},
+		{
+			usage: "bundle [flags]",
+			short: "pack a channel index with its archives into an offline bundle",
+			long:  bundleLong,
+			flags: bundleFlags,
+			run:   runBundle,
+		},
+		{
+			usage:   "unbundle <bundle> [flags]",
+			short:   "verify and extract an offline bundle",
+			long:    unbundleLong,
+			flags:   unbundleFlags,
+			run:     runUnbundle,
+			hasArgs: true,
+		},
+		{
+			usage: "keygen [flags]",
+			short: "generate an ed25519 key pair for signing",
+			long:  keygenLong,
+			flags: keygenFlags,
+			run:   runKeygen,
+		},
+		{
+			usage:   "verify-signature <file>... [flags]",
+			short:   "verify detached signatures of archives and indexes",
+			long:    verifySignatureLong,
+			flags:   verifySigFlags,
+			run:     runVerifySignature,
+			hasArgs: true,
+		},
+		{
+			usage:   "verify-provenance <archive>...",
+			short:   "check provenance attestations of archives",
+			long:    verifyProvenanceLong,
+			flags:   verifyProvFlags,
+			run:     runVerifyProvenance,
+			hasArgs: true,
+		},
+		{
+			usage:   "sbom [<archive>...] [flags]",
+			short:   "emit software bills of materials of module archives",
+			long:    sbomLong,
+			flags:   sbomFlags,
+			run:     runSbom,
+			hasArgs: true,
+		},
+		{
+			usage: "serve [flags]",
+			short: "serve the output directory like the public binary repository",
+			long:  serveLong,
+			flags: serveFlags,
+			run:   runServe,
+		},
+		{
+			usage: "mirror -base-url <url> [flags]",
+			short: "download a remote index and its archives into a local directory",
+			long:  mirrorLong,
+			flags: mirrorFlags,
+			run:   runMirror,
+		},
+		{
+			usage: "publish -base-url <url> [flags]",
+			short: "upload archives, sidecars and indexes to an Artifactory-compatible repository",
+			long:  publishLong,
+			flags: publishFlags,
+			run:   runPublish,
+		},
+		{
+			usage:   "oci-push <registry>/<repository> [flags]",
+			short:   "push modules and the index to an OCI registry",
+			long:    ociPushLong,
+			flags:   ociPushFlags,
+			run:     runOCIPush,
+			hasArgs: true,
+		},
+		{
+			usage:   "oci-pull <registry>/<repository>[:<tag>] [flags]",
+			short:   "pull modules and the index from an OCI registry",
+			long:    ociPullLong,
+			flags:   ociPullFlags,
+			run:     runOCIPull,
+			hasArgs: true,
+		},
+		{
+			usage: "manifests [flags]",
+			short: "render indexes as Kubernetes manifests",
+			long:  manifestsLong,
+			flags: manifestsFlags,
+			run:   runManifests,
+		},
+		{
+			usage: "apply [flags]",
+			short: "apply a channel index to a cluster with the server-side apply",
+			long:  applyLong,
+			flags: applyFlags,
+			run:   runApply,
+		},
+		{
+			usage:   "new <name> [flags]",
+			short:   "scaffold a new module",
+			long:    newLong,
+			flags:   newFlags,
+			run:     runNew,
+			hasArgs: true,
+		},
+		{
+			usage:   "release [<module>...] [flags]",
+			short:   "build modules, sidecars and indexes into the artifacts directory",
+			long:    releaseLong,
+			flags:   releaseFlags,
+			run:     runRelease,
+			hasArgs: true,
+		},
+		{
+			usage:   "check [<module>...] [flags]",
+			short:   "rebuild modules in a temporary worktree and compare with committed files",
+			long:    checkLong,
+			flags:   checkFlags,
+			run:     runCheck,
+			hasArgs: true,
+		},
+		{
+			usage:   "status [<module>...] [flags]",
+			short:   "show versions and unreleased changes of modules",
+			long:    statusLong,
+			flags:   statusFlags,
+			run:     runStatus,
+			hasArgs: true,
+		},
 	}
 )
 
+const yankLong = `ModuleBuilder yank is used to withdraw a released module version.
+
+The version stays in the release channel index, so clusters using it keep
+working, but its entry is marked with the -reason and the time of the yank.
+Yanked versions are skipped by resolve and sbom, never re-added by builds,
+and refused by check, status and prune -keep-referenced. As a
+side effect, the version is appended to the deprecates list of the module
+metadata.yaml in the current directory, which has to be committed along with
+the index. Yanking an already yanked version only updates the metadata.yaml.`
+
+const pruneLong = `ModuleBuilder prune is used to remove old module versions from the index.yaml and output directory.
+
+Retention policies apply to every module separately: -keep-majors keeps
+versions of the given number of latest majors and -keep-minors keeps the
+given number of latest minors of every major, a zero keeps all. Versions
+used in HostOSConfiguration objects of -keep-referenced files are always kept,
+the prune fails if any of them is yanked.
+Modules to remove are listed first, then they are dropped from the channel
+index and their archives are deleted from the -output directory along with
+every sidecar named after the archive, e.g. .metadata.yaml, signatures,
+provenance attestations and SBOMs. With -dry-run, modules are only listed.`
+
+const indexDiffLong = `ModuleBuilder index-diff is used to compare indexes between files or git revisions.
+
+A reference is either a git revision to load every channel index from,
+a path to an index file or a <revision>:<path> index file in git.
+The refA defaults to HEAD and the refB defaults to the working tree.
+A single index file is compared with its working tree version, e.g.
+HEAD~1:index.yaml, or its HEAD version with itself, e.g. index.yaml.
+
+Modules added, removed, re-hashed in every channel are reported along
+with modules moved from dev to release channels.`
+
+const indexMergeLong = `ModuleBuilder index-merge is used to merge several indexes into a single one.
+
+Modules of all indexes are united and sorted by name and version. The same
+module version with different sha256sums in several indexes is an error.
+If a file is prefixed with a namespace, names of its modules are prefixed
+with the namespace and a dash, e.g. upstream=index.yaml gives upstream-ntp.`
+
+const resolveLong = `ModuleBuilder resolve is used to find the newest module version satisfying a semver constraint.
+
+Release channels are searched, and dev channels as well if -dev is set.
+Versions deprecated in the module metadata.yaml or in the index and
+yanked versions are skipped. Dev versions satisfy a constraint if their
+version core does, e.g. 1.4.1-dev satisfies 1.x.`
+
+const bundleLong = `ModuleBuilder bundle is used to pack a channel index with its archives into an offline bundle.
+
+Every archive referenced by the channel index is taken from the output
+directory and verified against its sha256sum. The bundle is a reproducible
+tar.gz with the index, archives, their .metadata.yaml sidecars and the
+top-level SHA256SUMS file.`
+
+const unbundleLong = `ModuleBuilder unbundle is used to verify and extract an offline bundle.
+
+Before anything is written, every bundled file is checked against the
+SHA256SUMS file and every archive referenced by bundled indexes against its
+sha256sum, unless -verify=false is set. Only flat regular files are accepted,
+so entries can not escape the -dest directory, which is created if missing.
+Existing files with the same names are overwritten.`
+
+const keygenLong = `ModuleBuilder keygen is used to generate an ed25519 key pair for signing.
+
+The private key is written in the PEM encoded PKCS #8 form readable only by
+the owner, the public key in the PEM encoded PKIX form; existing files are
+overwritten. The key pair is meant for local testing, release keys should be
+kept in a secret store and passed to module and release commands with
+-signing-key or the $` + sign.KeyEnv + ` environment variable.`
+
+const verifySignatureLong = `ModuleBuilder verify-signature is used to verify detached signatures of archives and indexes.
+
+Every file is checked with the -public-key against the ed25519 signature
+next to it, e.g. index.yaml` + sign.Suffix + ` for index.yaml. All files are checked
+and reported, the command fails if any signature is missing or does not match.`
+
+const verifyProvenanceLong = `ModuleBuilder verify-provenance is used to check provenance attestations of archives.
+
+Provenance attestations are written by module and release commands with
+-provenance as in-toto statements with the SLSA provenance predicate next
+to archives, e.g. ntp-1.0.0.tgz` + provenance.Suffix + `. Every archive is checked to be
+a subject of its statement with the same sha256sum, then the git commit the
+archive is built from, the builder version and whether module sources had
+uncommitted changes are shown. The metadata.yaml version bump done by the
+build is not an uncommitted change, the committed version is shown instead.
+The statement itself is not signed.`
+
+const sbomLong = `ModuleBuilder sbom is used to emit software bills of materials of module archives.
+
+If no archives are given, every archive of the channel index is taken from
+the output directory, yanked versions are skipped. Archives of versions yanked
+in the channel are refused. Documents list files of an archive with checksums,
+ansible modules it ships and packages its playbooks install. Package names
+and versions templated from variables that cannot be resolved statically
+are marked as dynamic. A document is written next to its archive with the
+.spdx.json or .cdx.json suffix; SOURCE_DATE_EPOCH sets its creation time.`
+
+const serveLong = `ModuleBuilder serve is used to serve the output directory over HTTP like the public binary repository.
+
+Archives, indexes and sidecars are served under the /` + artifact.RepoPath + `/ path,
+so the management cluster can fetch locally built modules. Channel indexes
+are served from the repository if they are not copied to the output directory.
+ETag and Range requests are supported and every fetch is logged. Basic
+authentication is enabled with the user:password credentials.`
+
+const mirrorLong = `ModuleBuilder mirror is used to download a remote index and its archives into a local directory.
+
+The index is fetched from the base URL, e.g.
+https://binary.mirantis.com/` + artifact.RepoPath + `, and every archive not yet
+present in the destination is downloaded and verified against its sha256sum.
+Existing archives with a different sha256sum are never overwritten. Failed
+downloads are retried. The index is written only if all archives are mirrored.`
+
+const publishLong = `ModuleBuilder publish is used to upload archives, sidecars and indexes to an Artifactory-compatible repository.
+
+Archives referenced by channel indexes are taken from the output directory
+and uploaded over HTTP PUT with their .metadata.yaml sidecars and checksum
+headers, followed by the indexes. Artifacts already published with the same
+sha256sum are skipped, and released versions are never overwritten. Archives
+not built locally must be published already. Credentials are read from the
+$` + publish.AuthEnv + ` environment variable, either user:password or a token.`
+
+const ociPushLong = `ModuleBuilder oci-push is used to push modules and the index to an OCI registry.
+
+Every module of the channel index is pushed as an OCI artifact of the
+` + oci.ArtifactType + ` type to <repository>/<name>
+and tagged with its version. Manifest annotations hold the module name,
+version, sha256sum and the description of its metadata.yaml. The image index mirroring the channel
+index is tagged with its object name in <repository>, e.g. mcc-modules.
+Released versions are never overwritten. Credentials are read from the
+$` + oci.AuthEnv + ` environment variable as user:password.`
+
+const ociPullLong = `ModuleBuilder oci-pull is used to pull modules and the index from an OCI registry.
+
+The image index is taken from the reference tag or the channel object name.
+Archives of all modules it refers to are verified against their sha256sums
+and written to the destination along with the index reconstructed from the
+image index annotations.`
+
+const manifestsLong = `ModuleBuilder manifests is used to render indexes as Kubernetes manifests.
+
+HostOSConfigurationModules objects of channels are written as a multi-document
+YAML stream with the given labels and annotations. Objects are annotated with
+the builder version, the git commit and the build time, which is taken from
+SOURCE_DATE_EPOCH if set. With -kustomization, the kustomization.yaml referring
+to the output file is put next to it for GitOps tooling.`
+
+const applyLong = `ModuleBuilder apply is used to apply a channel index to a cluster with the server-side apply.
+
+Modules added, removed or re-hashed in the live HostOSConfigurationModules
+object of the channel apiVersion are shown first, then the object is applied with the dedicated field
+manager unless it is up to date. With -dry-run=server the request is only
+validated by the API server. The ` + apply.ProtectedName + ` object is synchronized from an
+external source and is never applied unless -force is set.`
+
+const newLong = `ModuleBuilder new is used to scaffold a new module.
+
+The module directory is created with metadata.yaml of the ` + domain.InitialVersion + ` version,
+the draft-07 schema.json with the common disable_reboot_request property,
+the main.yaml playbook and the README.md stub. The docURL is derived from
+the -doc-url-base flag or the docURLBase of the configuration file. The
+next build bumps the module to the first dev version and adds it to the
+dev indexes.`
+
+const releaseLong = `ModuleBuilder release is used to run the whole release pipeline.
+
+Modules, all if none given, are built into the artifacts directory, cleaned
+beforehand unless -clean=false is set. Every archive and index gets the
+.metadata.yaml sidecar, indexes are sorted and copied next to archives.
+With -check-diff, the release fails if the build has changed committed files.
+With -promote and -commit, promoted modules and indexes are committed with
+the "` + release.CommitSubject + `" message listing promoted versions.`
+
+const checkLong = `ModuleBuilder check is used to verify that committed modules and indexes are up to date.
+
+Modules, all if none given, of the -ref git revision are rebuilt in a
+temporary worktree, so the checkout is left untouched. Metadata versions,
+index entries and archive sha256sums of the rebuild are compared with the
+committed ones and every difference is explained, e.g. an archive differing
+from the index while the metadata version has not been bumped. A metadata
+version yanked in a channel index is a problem as well.`
+
+const statusLong = `ModuleBuilder status is used to show versions and unreleased changes of modules.
+
+For every module directory, all if none given, the metadata.yaml version,
+the latest versions in release and dev channels, uncommitted changes in
+the working tree and the number of commits changing the module since the
+last commit with its released version are shown. A metadata.yaml version
+yanked in a channel is marked, such a module is unreleased.`
+
 func init() {
+	flag.StringVar(&configFile, "config", config.FileName, "repo-level configuration file with index channels")
+	flag.StringVar(&outputFormat, "format", formatText, "output format of command results, one of [text, json]")
+
 	moduleFlags.StringVar(&outputDir, "output", "_artifacts", "output directory for archives")
 	moduleFlags.Var(&promoteType, "promote", "promotion type for modules, disabled if empty")
+	moduleFlags.StringVar(&replaceReason, "force-replace", "", "reason to replace released modules having a different sha256sum, recorded in the index entry, disabled if empty")
+	moduleFlags.BoolVar(&withProvenance, "provenance", false, "write provenance attestations of archives")
+	moduleFlags.StringVar(&signingKey, "signing-key", "", "ed25519 private key to sign archives and indexes, $"+sign.KeyEnv+" if empty, disabled if both are empty")
 
 	cleanFlags.StringVar(&outputDir, "output", "_artifacts", "output directory for archives")
 
+	sortFlags.BoolVar(&sortCheck, "check", false, "fail if indexes are not sorted without rewriting them")
+
+	yankFlags.StringVar(&yankReason, "reason", "", "reason to withdraw the module version (required)")
+	yankFlags.StringVar(&yankChannel, "channel", "release", "channel with the released module version")
+
+	pruneFlags.StringVar(&pruneCfg.Output, "output", "_artifacts", "output directory for archives")
+	pruneFlags.IntVar(&pruneCfg.KeepMajors, "keep-majors", 0, "number of latest majors to keep per module, all if zero")
+	pruneFlags.IntVar(&pruneCfg.KeepMinors, "keep-minors", 0, "number of latest minors to keep per major, all if zero")
+	pruneFlags.Var((*listFlag)(&pruneCfg.References), "keep-referenced", "HostOSConfiguration file with module versions to keep, may be repeated")
+	pruneFlags.BoolVar(&pruneCfg.DryRun, "dry-run", false, "only print modules to remove")
+	pruneFlags.StringVar(&pruneChannel, "channel", "release", "channel to prune")
+
+	diffFlags.StringVar(&outputFormat, "format", formatText, "output format of command results, one of [text, json], same as the global -format flag")
+
+	mergeFlags.StringVar(&mergeCfg.Output, "o", "", "merged index file, printed to stdout if empty")
+	mergeFlags.StringVar(&mergeCfg.Name, "name", "", "merged HostOSConfigurationModules object name (required)")
+	mergeFlags.StringVar(&mergeCfg.APIVersion, "api-version", domain.HOCMAPIVersion, "merged HostOSConfigurationModules object apiVersion")
+
+	resolveFlags.BoolVar(&resolveDev, "dev", false, "search in dev channels as well")
+
+	bundleFlags.StringVar(&bundleChannel, "channel", "release", "channel to bundle")
+	bundleFlags.StringVar(&bundleCfg.Output, "output", "_artifacts", "output directory with archives")
+	bundleFlags.StringVar(&bundleCfg.File, "o", "", "bundle file, <channel>-bundle.tar.gz if empty")
+
+	unbundleFlags.StringVar(&unbundleCfg.Dest, "dest", ".", "directory to extract the bundle into")
+	unbundleFlags.BoolVar(&unbundleCfg.Verify, "verify", true, "validate checksums before extracting")
+
+	keygenFlags.StringVar(&privateKey, "private-key", "signing.key", "file to write the private key to")
+	keygenFlags.StringVar(&publicKey, "public-key", "signing.pub", "file to write the public key to")
+
+	verifySigFlags.StringVar(&publicKey, "public-key", "signing.pub", "ed25519 public key")
+
+	sbomFlags.StringVar(&sbomFormat, "sbom-format", string(sbom.FormatSPDX), "document format, one of [spdx, cyclonedx]")
+	sbomFlags.StringVar(&sbomChannel, "channel", "release", "channel with archives to describe if none given")
+	sbomFlags.StringVar(&sbomCfg.Output, "output", "_artifacts", "output directory with archives")
+
+	serveFlags.StringVar(&serveCfg.Addr, "addr", "127.0.0.1:8080", "address to listen on")
+	serveFlags.StringVar(&serveCfg.Output, "output", "_artifacts", "output directory with archives")
+	serveFlags.StringVar(&serveAuth, "basic-auth", "", "user:password to require basic authentication, $"+serve.AuthEnv+" if empty, disabled if both are empty")
+
+	mirrorFlags.StringVar(&mirrorCfg.BaseURL, "base-url", "", "repository URL (required)")
+	mirrorFlags.StringVar(&mirrorCfg.Index, "index", "index.yaml", "index file name relative to the repository URL")
+	mirrorFlags.StringVar(&mirrorCfg.Dest, "dest", "_mirror", "directory to put the index and archives to")
+	mirrorFlags.IntVar(&mirrorCfg.Parallel, "parallel", 4, "number of concurrent downloads")
+	mirrorFlags.IntVar(&mirrorCfg.Retries, "retries", 3, "number of retries of a failed download")
+
+	publishFlags.StringVar(&publishCfg.BaseURL, "base-url", "", "repository URL (required)")
+	publishFlags.StringVar(&publishCfg.Output, "output", "_artifacts", "output directory with archives")
+	publishFlags.Var((*listFlag)(&publishChans), "channel", "channel to publish, may be repeated, all if not set")
+	publishFlags.BoolVar(&publishCfg.DryRun, "dry-run", false, "only print artifacts to upload")
+
+	for _, fs := range []*flag.FlagSet{ociPushFlags, ociPullFlags} {
+		fs.StringVar(&ociChannel, "channel", "release", "channel to push or pull")
+	}
+	ociPushFlags.StringVar(&ociPushCfg.Output, "output", "_artifacts", "output directory with archives")
+	ociPushFlags.BoolVar(&ociPushCfg.PlainHTTP, "plain-http", false, "use HTTP instead of HTTPS")
+	ociPullFlags.StringVar(&ociPullCfg.Dest, "dest", ".", "directory to put the index and archives to")
+	ociPullFlags.BoolVar(&ociPullCfg.PlainHTTP, "plain-http", false, "use HTTP instead of HTTPS")
+
+	manifestsFlags.Var((*listFlag)(&manifestsChan), "channel", "channel to render, may be repeated, all if not set")
+	manifestsFlags.Var((*mapFlag)(&manifestsCfg.Labels), "label", "key=value label of objects, may be repeated")
+	manifestsFlags.Var((*mapFlag)(&manifestsCfg.Annotations), "annotation", "key=value annotation of objects, may be repeated")
+	manifestsFlags.StringVar(&manifestsCfg.Output, "o", "", "manifests file, printed to stdout if empty")
+	manifestsFlags.BoolVar(&manifestsCfg.Kustomization, "kustomization", false, "put kustomization.yaml next to the manifests file")
+
+	applyFlags.StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig file, $KUBECONFIG or ~/.kube/config if empty")
+	applyFlags.StringVar(&kubeContext, "context", "", "kubeconfig context, the current one if empty")
+	applyFlags.StringVar(&applyChannel, "channel", "dev", "channel to apply")
+	applyFlags.StringVar(&applyDryRun, "dry-run", "none", "one of [none, server]")
+	applyFlags.StringVar(&applyCfg.FieldManager, "field-manager", apply.FieldManager, "field manager of the applied object")
+	applyFlags.BoolVar(&applyCfg.Force, "force", false, "allow to apply the "+apply.ProtectedName+" object")
+	applyFlags.BoolVar(&applyCfg.ForceConflicts, "force-conflicts", false, "take ownership of fields managed by others")
+
+	newFlags.StringVar(&scaffoldCfg.Dir, "dir", ".", "directory to create the module in")
+	newFlags.StringVar(&scaffoldCfg.Description, "description", "", "module description, derived from the name if empty")
+	newFlags.StringVar(&scaffoldCfg.DocURLBase, "doc-url-base", "", "URL the module README is published under, docURLBase of the configuration if empty")
+
+	releaseFlags.StringVar(&outputDir, "output", "_artifacts", "artifacts directory")
+	releaseFlags.Var(&promoteType, "promote", "promotion type for modules, disabled if empty")
+	releaseFlags.StringVar(&replaceReason, "force-replace", "", "reason to replace released modules having a different sha256sum, recorded in the index entry, disabled if empty")
+	releaseFlags.BoolVar(&withProvenance, "provenance", false, "write provenance attestations of archives")
+	releaseFlags.StringVar(&signingKey, "signing-key", "", "ed25519 private key to sign archives and indexes, $"+sign.KeyEnv+" if empty, disabled if both are empty")
+	releaseFlags.BoolVar(&releaseCfg.Clean, "clean", true, "remove the artifacts directory before the build")
+	releaseFlags.BoolVar(&releaseCfg.CheckDiff, "check-diff", false, "fail if the build changes committed files")
+	releaseFlags.BoolVar(&releaseCfg.Commit, "commit", false, "commit promoted modules and indexes")
+
+	checkFlags.StringVar(&checkCfg.Ref, "ref", "HEAD", "git revision to check")
+
+	statusFlags.StringVar(&outputFormat, "format", formatText, "output format of command results, one of [text, json], same as the global -format flag")
+	statusFlags.BoolVar(&unreleased, "unreleased", false, "show only modules with changes not promoted yet")
+
 	for _, cmd := range commands {
 		name := cmd.name()
 		if cmd.flags == nil {
@@ -69,6 +627,68 @@ func init() {
 	}
 }
 
+// listFlag collects values of a repeated flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// mapFlag collects key=value pairs of a repeated flag.
+type mapFlag map[string]string
+
+func (m *mapFlag) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *mapFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, given %s", value)
+	}
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	(*m)[k] = v
+	return nil
+}
+
+// version is set during the build with -ldflags "-X main.version=...".
+var version string
+
+func builderVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return info.Main.Version
+}
+
 func output(msgs ...any) {
 	fmt.Fprintln(flag.CommandLine.Output(), msgs...)
 }
@@ -81,7 +701,7 @@ func usage() {
 	output()
 	output("Usage:")
 	output()
-	output("\tmodule-builder <command> [arguments]")
+	output("\tmodule-builder [-config file] [-format text|json] <command> [arguments]")
 	output()
 	output("The commands are:")
 	output()
@@ -91,8 +711,27 @@ func usage() {
 }
 
 func failf(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, format, args...)
-	os.Exit(1)
+	exitf(codeUsage, format, args...)
+}
+
+func loadConfig() *config.Config {
+	if _, err := os.Stat(configFile); err != nil && configFile != config.FileName {
+		exitf(codeConfig, "Loading configuration failed: %v\n", err) // only the default one is optional
+	}
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		exitf(codeConfig, "Loading configuration failed: %v\n", err)
+	}
+	return cfg
+}
+
+func loadChannel(name string) config.Channel {
+	ch, err := loadConfig().Channel(name)
+	if err != nil {
+		exitf(codeConfig, "Loading configuration failed: %v\n", err)
+	}
+	return ch
 }
 
 func findCommand(name string) *command {
@@ -130,32 +769,716 @@ func help(name string) {
 
 func runModules(args []string) {
 	if len(args) == 0 {
-		fmt.Println("No modules set, nothing to do.")
+		succeed(module.Result{Modules: []module.ModuleResult{}, Indexes: []string{}}, "No modules set, nothing to do.\n")
 		return
 	}
 
-	if err := module.Build(module.Config{
-		Promote:   promoteType,
-		Output:    outputDir,
-		Dirs:      args,
-		LogWriter: os.Stderr,
-	}); err != nil {
-		fmt.Printf("Build failed: %v\n", err)
-		os.Exit(2)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	res, err := module.Build(ctx, buildConfig(args))
+	if err != nil {
+		fail("Build", res, err)
+	}
+
+	succeed(res, "Build completed.\n")
+}
+
+// buildConfig returns the configuration to build modules
+// in the directories with the module and release flags.
+func buildConfig(dirs []string) module.Config {
+	key, err := sign.LoadPrivateKey(signingKey)
+	if err != nil && !errors.Is(err, sign.ErrNoKey) {
+		exitf(codeConfig, "Loading signing key failed: %v\n", err)
+	}
+
+	var prov *provenance.Builder
+	if withProvenance {
+		prov = &provenance.Builder{
+			ID:        "module-builder",
+			Version:   builderVersion(),
+			GoVersion: runtime.Version(),
+			Args:      os.Args[1:],
+		}
+	}
+
+	return module.Config{
+		Channels:      loadConfig().Channels,
+		Promote:       promoteType,
+		Output:        outputDir,
+		Dirs:          dirs,
+		LogWriter:     os.Stderr,
+		ReplaceReason: replaceReason,
+		SigningKey:    key,
+		Provenance:    prov,
+	}
+}
+
+func runRelease(args []string) {
+	if releaseCfg.Commit && promoteType == moduleversion.PromoteNone {
+		failf("-commit requires -promote\n")
+	}
+	if releaseCfg.Commit && releaseCfg.CheckDiff {
+		failf("-check-diff and -commit are mutually exclusive\n")
+	}
+
+	dirs := args
+	if len(dirs) == 0 {
+		var err error
+		if dirs, err = moduleDirs("."); err != nil {
+			exitf(codeFailed, "listing modules: %v\n", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	releaseCfg.LogWriter = os.Stderr
+	releaseCfg.Build = buildConfig(dirs)
+	res, err := release.Run(ctx, releaseCfg)
+	if err != nil {
+		fail("Release", res, err)
 	}
 
-	fmt.Println("Build completed.")
+	if res.Commit != "" {
+		succeed(res, "Release completed, promoted %d modules in %s.\n", len(res.Promoted), res.Commit)
+		return
+	}
+	succeed(res, "Release completed.\n")
 }
 
 func runSort(_ []string) {
-	if err := sort.Index(sort.Config{
+	res, err := sort.Index(sort.Config{
+		LogWriter: os.Stderr,
+		Check:     sortCheck,
+		Files:     loadConfig().Files(),
+	})
+	if err != nil {
+		fail("Sorting", res, err)
+	}
+
+	if sortCheck {
+		succeed(res, "Indexes are sorted.\n")
+		return
+	}
+
+	succeed(res, "Sorting completed.\n")
+}
+
+func runYank(args []string) {
+	if len(args) != 1 {
+		failf("exactly one <module>@<version> is required, given %d\n", len(args))
+	}
+
+	name, version, ok := strings.Cut(args[0], "@")
+	if !ok || name == "" || version == "" {
+		failf("malformed module %q, expected <module>@<version>\n", args[0])
+	}
+
+	res := domain.NameVersionTuple{Name: name, Version: version}
+	if err := yank.Module(context.Background(), yank.Config{
 		LogWriter: os.Stderr,
+		Dir:       name,
+		Version:   version,
+		Reason:    yankReason,
+		IndexFile: loadChannel(yankChannel).File,
 	}); err != nil {
-		fmt.Printf("Sorting failed: %v\n", err)
+		fail("Yank", res, err)
+	}
+
+	succeed(res, "Yank completed.\n")
+}
+
+func runPrune(_ []string) {
+	pruneCfg.LogWriter = os.Stderr
+	pruneCfg.ListWriter = os.Stdout
+	if isJSON() {
+		pruneCfg.ListWriter = io.Discard
+	}
+	pruneCfg.IndexFile = loadChannel(pruneChannel).File
+
+	pruned, err := prune.Index(context.Background(), pruneCfg)
+	res := struct {
+		DryRun  bool            `json:"dryRun"`
+		Removed []domain.Module `json:"removed"`
+	}{pruneCfg.DryRun, append([]domain.Module{}, pruned...)}
+	if err != nil {
+		fail("Pruning", res, err)
+	}
+
+	succeed(res, "Pruning completed.\n")
+}
+
+func runIndexDiff(args []string) {
+	if len(args) > 2 {
+		failf("at most two references are accepted, given %d\n", len(args))
+	}
+
+	cfg := indexdiff.Config{
+		LogWriter: os.Stderr,
+		Channels:  loadConfig().Channels,
+	}
+	if len(args) > 0 {
+		cfg.RefA = args[0]
+	}
+	if len(args) > 1 {
+		cfg.RefB = args[1]
+	}
+
+	report, err := indexdiff.Indexes(cfg)
+	if err != nil {
+		fail("Diff", nil, err)
+	}
+
+	if isJSON() {
+		succeed(report, "")
+		return
+	}
+
+	if err := report.WriteText(os.Stdout); err != nil {
+		exitf(codeFailed, "writing report: %v\n", err)
+	}
+}
+
+func runStatus(args []string) {
+	dirs := args
+	if len(dirs) == 0 {
+		var err error
+		if dirs, err = moduleDirs("."); err != nil {
+			exitf(codeFailed, "listing modules: %v\n", err)
+		}
+	}
+
+	modules, err := status.Modules(context.Background(), status.Config{
+		LogWriter: os.Stderr,
+		Dirs:      dirs,
+		Channels:  loadConfig().Channels,
+	})
+	if err != nil {
+		fail("Status", nil, err)
+	}
+
+	if unreleased {
+		modules = slices.DeleteFunc(modules, func(m status.Module) bool { return !m.Unreleased() })
+	}
+
+	if isJSON() {
+		succeed(modules, "")
+		return
+	}
+
+	if err := status.WriteTable(os.Stdout, modules); err != nil {
+		exitf(codeFailed, "writing status: %v\n", err)
+	}
+}
+
+func runCheck(args []string) {
+	dirs := args
+	if len(dirs) == 0 {
+		var err error
+		if dirs, err = moduleDirs("."); err != nil {
+			exitf(codeFailed, "listing modules: %v\n", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	checkCfg.LogWriter = os.Stderr
+	checkCfg.Dirs = dirs
+	checkCfg.Channels = loadConfig().Channels
+	report, err := check.Modules(ctx, checkCfg)
+	if err != nil {
+		fail("Check", nil, err)
+	}
+
+	if !isJSON() {
+		if err := report.WriteText(os.Stdout); err != nil {
+			exitf(codeFailed, "writing report: %v\n", err)
+		}
+	}
+	if !report.OK() {
+		fail("Check", report, fmt.Errorf("%w: %d problem(s) found", check.ErrDrift, len(report.Problems)))
+	}
+
+	succeed(report, "")
+}
+
+// moduleDirs returns directories with the metadata.yaml file.
+func moduleDirs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, e.Name(), "metadata.yaml")); err == nil {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// parseInterspersed parses flags placed both before and after arguments.
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = flags.Parse(args) // will exit on error
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...)
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runIndexMerge(args []string) {
+	if len(args) == 0 {
+		failf("at least one index file is required\n")
+	}
+
+	for _, arg := range args {
+		namespace, file, ok := strings.Cut(arg, "=")
+		if !ok {
+			namespace, file = "", arg
+		}
+		mergeCfg.Sources = append(mergeCfg.Sources, merge.Source{Namespace: namespace, File: file})
+	}
+	mergeCfg.LogWriter = os.Stderr
+
+	merged, err := merge.Indexes(context.Background(), mergeCfg)
+	if err != nil {
+		fail("Merge", nil, err)
+	}
+
+	if mergeCfg.Output == "" && !isJSON() {
+		if err := index.Encode(context.Background(), os.Stdout, merged); err != nil {
+			exitf(codeFailed, "writing index: %v\n", err)
+		}
+		return
+	}
+
+	succeed(merged, "Merge completed.\n")
+}
+
+func runResolve(args []string) {
+	if len(args) != 2 {
+		failf("exactly <module> and <constraint> are required, given %d arguments\n", len(args))
+	}
+
+	m, err := resolve.Module(context.Background(), resolve.Config{
+		LogWriter:  os.Stderr,
+		Name:       args[0],
+		Constraint: args[1],
+		Channels:   loadConfig().Channels,
+		Dev:        resolveDev,
+		ModulesDir: ".",
+	})
+	if err != nil {
+		fail("Resolve", nil, err)
+	}
+
+	res := struct {
+		domain.Module
+		Archive string `json:"archive"`
+	}{m, m.ArchiveName()}
+	succeed(res, "version: %s\nsha256sum: %s\narchive: %s\n", m.Version, m.Sha256Sum, res.Archive)
+}
+
+func runBundle(_ []string) {
+	bundleCfg.LogWriter = os.Stderr
+	bundleCfg.Channel = loadChannel(bundleChannel)
+	if bundleCfg.File == "" {
+		bundleCfg.File = bundleChannel + "-bundle.tar.gz"
+	}
+
+	res := struct {
+		File string `json:"file"`
+	}{bundleCfg.File}
+	if err := bundle.Create(context.Background(), bundleCfg); err != nil {
+		fail("Bundle", nil, err)
+	}
+
+	succeed(res, "Bundle completed.\n")
+}
+
+func runUnbundle(args []string) {
+	if len(args) != 1 {
+		failf("exactly one bundle is required, given %d\n", len(args))
+	}
+
+	unbundleCfg.LogWriter = os.Stderr
+	unbundleCfg.File = args[0]
+	res := struct {
+		File string `json:"file"`
+		Dest string `json:"dest"`
+	}{unbundleCfg.File, unbundleCfg.Dest}
+	if err := bundle.Extract(unbundleCfg); err != nil {
+		fail("Unbundle", nil, err)
+	}
+
+	succeed(res, "Unbundle completed.\n")
+}
+
+func runKeygen(_ []string) {
+	if err := sign.GenerateKey(privateKey, publicKey); err != nil {
+		fail("Key generation", nil, err)
+	}
+
+	res := struct {
+		PrivateKey string `json:"privateKey"`
+		PublicKey  string `json:"publicKey"`
+	}{privateKey, publicKey}
+	succeed(res, "Keys written to %s and %s.\n", privateKey, publicKey)
+}
+
+func runVerifySignature(args []string) {
+	if len(args) == 0 {
+		failf("at least one file is required\n")
+	}
+
+	key, err := sign.LoadPublicKey(publicKey)
+	if err != nil {
+		exitf(codeConfig, "Loading public key failed: %v\n", err)
+	}
+
+	var (
+		results = make([]verification, 0, len(args))
+		merr    error
+	)
+	for _, name := range args {
+		if err := sign.Verify(key, name, name+sign.Suffix); err != nil {
+			results = append(results, verification{File: name, Error: err.Error()})
+			merr = errors.Join(merr, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		results = append(results, verification{File: name, OK: true})
+	}
+
+	reportVerifications(results, merr)
+}
+
+func runVerifyProvenance(args []string) {
+	if len(args) == 0 {
+		failf("at least one archive is required\n")
+	}
+
+	var (
+		results = make([]verification, 0, len(args))
+		merr    error
+	)
+	for _, name := range args {
+		st, err := provenance.Read(name + provenance.Suffix)
+		if err == nil {
+			err = provenance.Verify(st, name)
+		}
+		if err != nil {
+			results = append(results, verification{File: name, Error: err.Error()})
+			merr = errors.Join(merr, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		var commit string
+		if deps := st.Predicate.BuildDefinition.ResolvedDependencies; len(deps) > 0 {
+			commit = deps[0].Digest["gitCommit"]
+		}
+		builder := st.Predicate.RunDetails.Builder
+		params := st.Predicate.BuildDefinition.InternalParameters
+		detail := fmt.Sprintf("commit %s, dirty %t", commit, params.Dirty)
+		if params.SourceVersion != "" {
+			detail += ", bumped from " + params.SourceVersion
+		}
+		results = append(results, verification{
+			File:          name,
+			OK:            true,
+			Commit:        commit,
+			Dirty:         &params.Dirty,
+			SourceVersion: params.SourceVersion,
+			Detail: fmt.Sprintf("%s, builder %s %s (%s)", detail,
+				builder.ID, builder.Version[builder.ID], builder.Version["go"]),
+		})
+	}
+
+	reportVerifications(results, merr)
+}
+
+// verification is the result of a single file verification.
+type verification struct {
+	File   string `json:"file"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Dirty  *bool  `json:"dirty,omitempty"`
+
+	SourceVersion string `json:"sourceVersion,omitempty"` // committed version bumped by the build
+	Detail        string `json:"-"`                       // printed after the file in the text format
+}
+
+// reportVerifications prints verification results and exits on failures.
+func reportVerifications(results []verification, merr error) {
+	if isJSON() {
+		if merr != nil {
+			fail("Verification", results, fmt.Errorf("%w: %w", errVerification, merr))
+		}
+		succeed(results, "")
+		return
+	}
+
+	for _, r := range results {
+		switch {
+		case !r.OK:
+			fmt.Printf("FAIL %s: %s\n", r.File, r.Error)
+		case r.Detail != "":
+			fmt.Printf("OK %s: %s\n", r.File, r.Detail)
+		default:
+			fmt.Printf("OK %s\n", r.File)
+		}
+	}
+
+	if merr != nil {
 		os.Exit(2)
 	}
+}
+
+func runSbom(args []string) {
+	created, err := artifact.BuildTime()
+	if err != nil {
+		failf("%v\n", err)
+	}
+
+	sbomCfg.LogWriter = os.Stderr
+	sbomCfg.Format = sbom.Format(sbomFormat)
+	sbomCfg.Created = created
+	sbomCfg.Archives = args
+	sbomCfg.Channel = loadChannel(sbomChannel)
+
+	written, err := sbom.Generate(context.Background(), sbomCfg)
+	res := struct {
+		Written []string `json:"written"`
+	}{append([]string{}, written...)}
+
+	for _, name := range written {
+		if isJSON() {
+			break
+		}
+		fmt.Printf("Written %s\n", name)
+	}
+	if err != nil {
+		fail("SBOM", res, err)
+	}
+
+	succeed(res, "SBOM completed.\n")
+}
+
+func runServe(_ []string) {
+	if serveAuth == "" {
+		serveAuth = os.Getenv(serve.AuthEnv)
+	}
+	if serveAuth != "" {
+		var ok bool
+		serveCfg.Username, serveCfg.Password, ok = strings.Cut(serveAuth, ":")
+		if !ok || serveCfg.Username == "" {
+			failf("basic authentication credentials must be user:password\n")
+		}
+	}
+
+	serveCfg.LogWriter = os.Stderr
+	serveCfg.Channels = loadConfig().Channels
+	if err := serve.Run(serveCfg); err != nil {
+		fail("Serve", nil, err)
+	}
+}
+
+func runMirror(_ []string) {
+	if mirrorCfg.BaseURL == "" {
+		failf("-base-url is required\n")
+	}
+
+	mirrorCfg.LogWriter = os.Stderr
+	res, err := mirror.Modules(mirrorCfg)
+	if err != nil {
+		fail("Mirror", res, err)
+	}
+
+	succeed(res, "Mirror completed: %d downloaded, %d present.\n", len(res.Downloaded), len(res.Present))
+}
+
+func runPublish(_ []string) {
+	if publishCfg.BaseURL == "" {
+		failf("-base-url is required\n")
+	}
+
+	publishCfg.Channels = loadConfig().Channels
+	if len(publishChans) > 0 {
+		publishCfg.Channels = nil
+		for _, name := range publishChans {
+			publishCfg.Channels = append(publishCfg.Channels, loadChannel(name))
+		}
+	}
+
+	publishCfg.LogWriter = os.Stderr
+	publishCfg.Auth = os.Getenv(publish.AuthEnv)
+	res, err := publish.Artifacts(context.Background(), publishCfg)
+	if err != nil {
+		fail("Publish", res, err)
+	}
+
+	succeed(res, "Publish completed: %d uploaded, %d skipped.\n", len(res.Uploaded), len(res.Skipped))
+}
+
+func runOCIPush(args []string) {
+	if len(args) != 1 {
+		failf("exactly one repository is required, given %d\n", len(args))
+	}
+
+	ociPushCfg.LogWriter = os.Stderr
+	ociPushCfg.Repository = args[0]
+	ociPushCfg.Auth = os.Getenv(oci.AuthEnv)
+	ociPushCfg.Channel = loadChannel(ociChannel)
+	res := struct {
+		Repository string `json:"repository"`
+		Channel    string `json:"channel"`
+		Tag        string `json:"tag"`
+	}{ociPushCfg.Repository, ociPushCfg.Channel.Name, ociPushCfg.Channel.ObjectName}
+	if err := oci.Push(context.Background(), ociPushCfg); err != nil {
+		fail("OCI push", res, err)
+	}
+
+	succeed(res, "OCI push completed.\n")
+}
+
+func runOCIPull(args []string) {
+	if len(args) != 1 {
+		failf("exactly one repository is required, given %d\n", len(args))
+	}
+
+	ociPullCfg.LogWriter = os.Stderr
+	ociPullCfg.Repository = args[0]
+	ociPullCfg.Auth = os.Getenv(oci.AuthEnv)
+	ociPullCfg.Tag = loadChannel(ociChannel).ObjectName
+	idx, err := oci.Pull(context.Background(), ociPullCfg)
+	if err != nil {
+		fail("OCI pull", nil, err)
+	}
+
+	succeed(idx, "OCI pull completed: %d modules of %s.\n", len(idx.Spec.Modules), idx.Metadata.Name)
+}
+
+func runManifests(_ []string) {
+	if manifestsCfg.Kustomization && manifestsCfg.Output == "" {
+		failf("-kustomization requires -o\n")
+	}
+
+	buildTime, err := artifact.BuildTime()
+	if err != nil {
+		failf("%v\n", err)
+	}
+
+	manifestsCfg.Channels = loadConfig().Channels
+	if len(manifestsChan) > 0 {
+		manifestsCfg.Channels = nil
+		for _, name := range manifestsChan {
+			manifestsCfg.Channels = append(manifestsCfg.Channels, loadChannel(name))
+		}
+	}
+
+	manifestsCfg.LogWriter = os.Stderr
+	manifestsCfg.BuilderVersion = builderVersion()
+	manifestsCfg.BuildTime = buildTime
+	if src, err := provenance.GitSource(""); err == nil {
+		manifestsCfg.GitCommit = src.Commit
+	} else {
+		log.Printf("WARNING: git commit is not annotated: %v", err)
+	}
+
+	objects, err := manifests.Render(context.Background(), manifestsCfg)
+	if err != nil {
+		fail("Manifests", nil, err)
+	}
+
+	if manifestsCfg.Output == "" && !isJSON() {
+		if err := manifests.Encode(context.Background(), os.Stdout, objects); err != nil {
+			exitf(codeFailed, "writing manifests: %v\n", err)
+		}
+		return
+	}
+
+	succeed(objects, "Manifests completed.\n")
+}
+
+func runApply(_ []string) {
+	switch applyDryRun {
+	case "none":
+	case "server":
+		applyCfg.DryRun = true
+	default:
+		failf("-dry-run must be one of [none, server], given %s\n", applyDryRun)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	if err != nil {
+		exitf(codeConfig, "Loading kubeconfig failed: %v\n", err)
+	}
+
+	applyCfg.Client, err = dynamic.NewForConfig(restConfig)
+	if err != nil {
+		exitf(codeConfig, "Creating client failed: %v\n", err)
+	}
+
+	var diff strings.Builder
+	applyCfg.LogWriter = os.Stderr
+	applyCfg.DiffWriter = os.Stdout
+	if isJSON() {
+		applyCfg.DiffWriter = &diff
+	}
+	applyCfg.Channel = loadChannel(applyChannel)
+
+	changed, err := apply.Object(context.Background(), applyCfg)
+	res := struct {
+		Object  string `json:"object"`
+		Changed bool   `json:"changed"`
+		DryRun  bool   `json:"dryRun"`
+		Diff    string `json:"diff,omitempty"`
+	}{applyCfg.Channel.ObjectName, changed, applyCfg.DryRun, diff.String()}
+	if err != nil {
+		fail("Apply", res, err)
+	}
 
-	fmt.Println("Sorting completed.")
+	succeed(res, "Apply completed.\n")
+}
+
+func runNew(args []string) {
+	if len(args) != 1 {
+		failf("exactly one module name is required, given %d\n", len(args))
+	}
+
+	scaffoldCfg.LogWriter = os.Stderr
+	scaffoldCfg.Name = args[0]
+	if scaffoldCfg.DocURLBase == "" {
+		scaffoldCfg.DocURLBase = loadConfig().DocURLBase
+	}
+
+	dir, err := scaffold.Module(scaffoldCfg)
+	if err != nil {
+		fail("New", nil, err)
+	}
+
+	res := struct {
+		Name string `json:"name"`
+		Dir  string `json:"dir"`
+	}{scaffoldCfg.Name, dir}
+	succeed(res, "Module created in %s.\n", dir)
 }
 
 func main() {
@@ -189,8 +1512,19 @@ func main() {
 		os.Exit(2)
 	}
 
-	_ = cmd.flags.Parse(args[1:]) // will exit on error
-	args = cmd.flags.Args()
+	commandName = cmd.name()
+	if cmd.interspersed {
+		args = parseInterspersed(cmd.flags, args[1:])
+	} else {
+		_ = cmd.flags.Parse(args[1:]) // will exit on error
+		args = cmd.flags.Args()
+	}
+
+	// checked once commands aliasing the global -format flag are parsed
+	if f := outputFormat; f != formatText && f != formatJSON {
+		outputFormat = formatText
+		failf("unknown format %q, expected one of [text, json]\n", f)
+	}
 	if !cmd.hasArgs && len(args) > 0 {
 		help(cmd.name())
 		failf("command %s does not accept any arguments\n", cmd.name())
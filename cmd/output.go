@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Mirantis/host-os-modules/cmd/internal/apply"
+	"github.com/Mirantis/host-os-modules/cmd/internal/bundle"
+	"github.com/Mirantis/host-os-modules/cmd/internal/check"
+	"github.com/Mirantis/host-os-modules/cmd/internal/mirror"
+	"github.com/Mirantis/host-os-modules/cmd/internal/module"
+	"github.com/Mirantis/host-os-modules/cmd/internal/oci"
+	"github.com/Mirantis/host-os-modules/cmd/internal/publish"
+	"github.com/Mirantis/host-os-modules/cmd/internal/release"
+	"github.com/Mirantis/host-os-modules/cmd/internal/resolve"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sign"
+	"github.com/Mirantis/host-os-modules/cmd/internal/sort"
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+// Output formats of the global -format flag.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// Error codes of the structured output.
+const (
+	codeUsage            = "usage"              // malformed arguments or flags
+	codeConfig           = "config"             // configuration can not be loaded
+	codeFailed           = "failed"             // any other failure
+	codeNotFound         = "not_found"          // module or file does not exist
+	codeUnsorted         = "unsorted"           // index is not sorted
+	codeReleased         = "released_overwrite" // released artifact would be replaced
+	codeChecksumMismatch = "checksum_mismatch"  // downloaded or extracted file is corrupted
+	codeProtected        = "protected_object"   // object must not be applied
+	codeVerification     = "verification"       // signature or provenance is invalid
+	codeDrift            = "drift"              // build changes committed files
+	codeYanked           = "yanked"             // withdrawn module version is selected
+)
+
+var (
+	outputFormat string // global -format flag
+	commandName  string // the running command
+
+	errVerification = errors.New("verification failed")
+)
+
+type (
+	// envelope is printed to stdout by every command with -format json.
+	envelope struct {
+		Command string        `json:"command"`
+		OK      bool          `json:"ok"`
+		Result  any           `json:"result,omitempty"`
+		Error   *commandError `json:"error,omitempty"`
+	}
+
+	commandError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+func isJSON() bool {
+	return outputFormat == formatJSON
+}
+
+// succeed prints the result of the command, or the formatted
+// message if the output format is text.
+func succeed(res any, format string, args ...any) {
+	if isJSON() {
+		emit(envelope{Command: commandName, OK: true, Result: res})
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// fail prints the error with the partial result of the command and exits.
+func fail(action string, res any, err error) {
+	if isJSON() {
+		emit(envelope{
+			Command: commandName,
+			Result:  res,
+			Error:   &commandError{Code: errorCode(err), Message: err.Error()},
+		})
+	} else {
+		fmt.Printf("%s failed: %v\n", action, err)
+	}
+	os.Exit(2)
+}
+
+// exitf prints the error with the code and exits, the message
+// goes to stderr if the output format is text.
+func exitf(code, format string, args ...any) {
+	if isJSON() {
+		emit(envelope{
+			Command: commandName,
+			Error:   &commandError{Code: code, Message: fmt.Sprintf(format, args...)},
+		})
+	} else {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+	os.Exit(1)
+}
+
+func emit(e envelope) {
+	if e.Error != nil {
+		e.Error.Message = strings.TrimRight(e.Error.Message, "\n")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "writing result: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// errorCode maps known errors of commands to codes.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, module.ErrReleased),
+		errors.Is(err, publish.ErrReleased),
+		errors.Is(err, oci.ErrReleased):
+		return codeReleased
+	case errors.Is(err, sort.ErrUnsorted):
+		return codeUnsorted
+	case errors.Is(err, mirror.ErrMismatch),
+		errors.Is(err, bundle.ErrMismatch):
+		return codeChecksumMismatch
+	case errors.Is(err, release.ErrDrift),
+		errors.Is(err, check.ErrDrift):
+		return codeDrift
+	case errors.Is(err, domain.ErrYanked):
+		return codeYanked
+	case errors.Is(err, apply.ErrProtected):
+		return codeProtected
+	case errors.Is(err, errVerification),
+		errors.Is(err, sign.ErrMismatch):
+		return codeVerification
+	case errors.Is(err, resolve.ErrNotFound),
+		errors.Is(err, os.ErrNotExist):
+		return codeNotFound
+	default:
+		return codeFailed
+	}
+}
@@ -0,0 +1,231 @@
+// Package archive builds and verifies reproducible tar.gz archives of modules.
+//
+// Archives of the same module files are byte-to-byte identical regardless
+// of the file owners, modes and modification times, hence the sha256sum
+// of an archive identifies the module version in indexes.
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+// ErrMismatch is returned if the archive does not match the expected sha256sum.
+var ErrMismatch = errors.New("sha256sum mismatch")
+
+// Result describes the built archive.
+type Result struct {
+	Path      string // archive file
+	Sha256Sum string
+	Size      int64 // in bytes
+}
+
+// Build writes the archive of the module directory to the
+// <outputDir>/<name>-<version>.tgz file and calculates its sha256sum and size.
+func Build(ctx context.Context, dir string, m domain.NameVersionTuple, outputDir string) (Result, error) {
+	name := filepath.Join(outputDir, m.String()+".tgz")
+
+	tmpFile, err := os.CreateTemp(outputDir, m.String()+"-*")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name()) // no-op once renamed
+	defer tmpFile.Close()
+
+	var (
+		hash = sha256.New()
+		size = &countWriter{}
+	)
+	if err := Write(ctx, dir, io.MultiWriter(hash, size, tmpFile)); err != nil {
+		return Result{}, fmt.Errorf("build the archive %s: %w", name, err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return Result{}, fmt.Errorf("failed to close %s: %w", tmpFile.Name(), err)
+	}
+	if err := os.Rename(tmpFile.Name(), name); err != nil {
+		return Result{}, fmt.Errorf("failed to move %s to %s: %w", tmpFile.Name(), name, err)
+	}
+
+	return Result{
+		Path:      name,
+		Sha256Sum: hex.EncodeToString(hash.Sum(nil)),
+		Size:      size.n,
+	}, nil
+}
+
+// countWriter counts bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Write writes the reproducible tar.gz archive of the root directory to w.
+func Write(ctx context.Context, root string, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	defer gw.Close()
+
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	walkErr := filepath.Walk(root, func(filePath string, fileInfo fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Make path inside archive relative to root
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to compute relative path: %w", err)
+		}
+		// Normalize to forward slashes (POSIX style)
+		relPath = filepath.ToSlash(relPath)
+
+		// Special case for the root itself: skip adding
+		if relPath == "." {
+			return nil
+		}
+
+		// Create tar header from FileInfo
+		header, err := tar.FileInfoHeader(fileInfo, "")
+		if err != nil {
+			return fmt.Errorf("failed to create header for %s: %w", filePath, err)
+		}
+
+		// Ensure reproducibility
+		header.Name = relPath
+		if fileInfo.IsDir() {
+			// Directory entries should end with "/"
+			header.Name += "/"
+			header.Mode = 0o755
+		} else {
+			header.Mode = 0o600
+		}
+		header.ModTime = time.Unix(0, 0)
+		header.ChangeTime = time.Unix(0, 0)
+		header.AccessTime = time.Unix(0, 0)
+		header.Uid = 0
+		header.Gid = 0
+		header.Gname = "root"
+		header.Uname = "root"
+
+		// Write header
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write header for %s: %w", relPath, err)
+		}
+
+		// Write file contents if it's a regular file
+		if fileInfo.Mode().IsRegular() {
+			file, err := os.Open(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", filePath, err)
+			}
+			defer file.Close()
+
+			if _, err := io.Copy(tw, file); err != nil {
+				return fmt.Errorf("failed to copy file %s into archive: %w", relPath, err)
+			}
+		}
+
+		return nil
+	})
+
+	if walkErr != nil {
+		return fmt.Errorf("failed to build an archive: %w", walkErr)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to close tar: %w", err)
+	}
+	return gw.Close()
+}
+
+// Sha256 calculates the sha256sum of the file.
+func Sha256(ctx context.Context, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, ctxReader{ctx, f}); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Verify checks that the archive matches the sha256sum and
+// consists of entries normalized by Write.
+func Verify(ctx context.Context, name, sha256sum string) error {
+	got, err := Sha256(ctx, name)
+	if err != nil {
+		return err
+	}
+	if got != sha256sum {
+		return fmt.Errorf("%s sha256sum %s, expected %s: %w", name, got, sha256sum, ErrMismatch)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(ctxReader{ctx, f})
+	if err != nil {
+		return fmt.Errorf("failed to read gzip %s: %w", name, err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar %s: %w", name, err)
+		}
+
+		if !header.ModTime.Equal(time.Unix(0, 0)) || header.Uid != 0 || header.Gid != 0 {
+			return fmt.Errorf("%s: entry %s is not reproducible", name, header.Name)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("failed to read tar %s: %w", name, err)
+		}
+	}
+}
+
+// ctxReader stops reading once the context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
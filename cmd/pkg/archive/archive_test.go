@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+)
+
+func TestBuildIsReproducible(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ntp")
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"metadata.yaml":  "name: ntp\nversion: 1.0.0\n",
+		"files/ntp.conf": "server pool.ntp.org\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := domain.NameVersionTuple{Name: "ntp", Version: "1.0.0"}
+	first, err := Build(context.Background(), dir, m, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(first.Path) != "ntp-1.0.0.tgz" {
+		t.Errorf("unexpected archive %s", first.Path)
+	}
+
+	// owners, modes and times do not affect the archive
+	if err := os.Chtimes(filepath.Join(dir, "metadata.yaml"), time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "files/ntp.conf"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := Build(context.Background(), dir, m, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Sha256Sum != second.Sha256Sum || first.Size != second.Size {
+		t.Errorf("archives differ: %+v and %+v", first, second)
+	}
+
+	if err := Verify(context.Background(), second.Path, first.Sha256Sum); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := Verify(context.Background(), second.Path, "0000"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify with a wrong sha256sum: %v, want %v", err, ErrMismatch)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Build(ctx, dir, m, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Build with canceled context: %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package domain
+
+const (
+	// Index file and object names of the upstream release and dev channels.
+	ReleaseIndexFileName = "index.yaml"
+	DevIndexFileName     = "index-dev.yaml"
+	DevHOCMObjName       = "dev-mcc-modules"
+	ReleaseHOCMObjName   = "mcc-modules"
+
+	// HOCMAPIVersion and HOCMKind identify the HostOSConfigurationModules object.
+	HOCMAPIVersion = "kaas.mirantis.com/v1alpha1"
+	HOCMKind       = "HostOSConfigurationModules"
+
+	// InitialVersion is the version of scaffolded modules,
+	// bumped to the first dev version on the next build.
+	InitialVersion = "0.0.0"
+)
@@ -0,0 +1,132 @@
+// Package domain defines host OS configuration modules and the
+// HostOSConfigurationModules index object listing their archives.
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrYanked is returned if a withdrawn module version is selected.
+var ErrYanked = errors.New("module version is yanked")
+
+type (
+	// HostOSConfigurationModules emulates the CRD HostOSConfigurationModules
+	// object from the kaas/core.
+	HostOSConfigurationModules struct {
+		APIVersion string `yaml:"apiVersion" json:"apiVersion"`
+		Kind       string `yaml:"kind" json:"kind"`
+		Metadata   struct {
+			Name        string            `yaml:"name" json:"name"`
+			Labels      map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+			Annotations map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+		} `yaml:"metadata" json:"metadata"`
+		Spec struct {
+			Modules []Module `yaml:"modules" json:"modules"`
+		} `yaml:"spec" json:"spec"`
+	}
+
+	// Module is a minimal required structure to represent a module.
+	Module struct {
+		NameVersionTuple `yaml:",inline"`
+		Sha256Sum        string `yaml:"sha256sum" json:"sha256sum"`
+
+		// YankReason and YankedAt are set once a released
+		// module version is withdrawn.
+		YankReason string     `yaml:"yankReason,omitempty" json:"yankReason,omitempty"`
+		YankedAt   *time.Time `yaml:"yankedAt,omitempty" json:"yankedAt,omitempty"`
+
+		// ReplaceReason and ReplacedAt are set once a released
+		// module version is forcibly rebuilt with a different archive.
+		ReplaceReason string     `yaml:"replaceReason,omitempty" json:"replaceReason,omitempty"`
+		ReplacedAt    *time.Time `yaml:"replacedAt,omitempty" json:"replacedAt,omitempty"`
+
+		// Optional fields copied from the module metadata.yaml
+		// and the archive, set only for enriched channels.
+		Description            string        `yaml:"description,omitempty" json:"description,omitempty"`
+		DocURL                 string        `yaml:"docURL,omitempty" json:"docURL,omitempty"`
+		SupportedDistributions []string      `yaml:"supportedDistributions,omitempty" json:"supportedDistributions,omitempty"`
+		Deprecates             []Deprecation `yaml:"deprecates,omitempty" json:"deprecates,omitempty"`
+		Size                   int64         `yaml:"size,omitempty" json:"size,omitempty"` // archive size in bytes
+	}
+
+	// Metadata represents the metadata.yaml file of a module.
+	Metadata struct {
+		NameVersionTuple       `yaml:",inline"`
+		Description            string        `yaml:"description" json:"description"`
+		ValuesJSONSchema       string        `yaml:"valuesJsonSchema" json:"valuesJsonSchema"`
+		DocURL                 string        `yaml:"docURL" json:"docURL"`
+		Playbook               string        `yaml:"playbook" json:"playbook"`
+		SupportedDistributions []string      `yaml:"supportedDistributions,omitempty" json:"supportedDistributions,omitempty"`
+		Deprecates             []Deprecation `yaml:"deprecates,omitempty" json:"deprecates,omitempty"`
+	}
+
+	// Deprecation is a module version deprecated by a newer one.
+	Deprecation struct {
+		Version string `yaml:"version" json:"version"`
+	}
+
+	// NameVersionTuple represents a pair of name-version both required
+	// during deserialization from YAML format.
+	NameVersionTuple struct {
+		Name    string `yaml:"name" json:"name"`
+		Version string `yaml:"version" json:"version"`
+	}
+)
+
+// IsEmpty reports whether the object is not initialized or lists no modules.
+func (m HostOSConfigurationModules) IsEmpty() bool {
+	return m.APIVersion == "" || m.Kind == "" || m.Metadata.Name == "" ||
+		len(m.Spec.Modules) == 0
+}
+
+// Find returns the position of the module with the given name and version,
+// or -1 if there is no such module.
+func (m HostOSConfigurationModules) Find(t NameVersionTuple) int {
+	for i, module := range m.Spec.Modules {
+		if module.NameVersionTuple == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// String returns the <name>-<version> form of the tuple.
+func (t NameVersionTuple) String() string {
+	return str(t.Name, t.Version)
+}
+
+// IsEqual reports whether both modules have the same name, version and sha256sum.
+func (m Module) IsEqual(a Module) bool {
+	return m.NameVersionTuple == a.NameVersionTuple && m.Sha256Sum == a.Sha256Sum
+}
+
+// IsYanked reports whether the module version has been withdrawn.
+func (m Module) IsYanked() bool {
+	return m.YankedAt != nil
+}
+
+// Minimal returns the module without optional fields.
+func (m Module) Minimal() Module {
+	return Module{
+		NameVersionTuple: m.NameVersionTuple,
+		Sha256Sum:        m.Sha256Sum,
+		YankReason:       m.YankReason,
+		YankedAt:         m.YankedAt,
+		ReplaceReason:    m.ReplaceReason,
+		ReplacedAt:       m.ReplacedAt,
+	}
+}
+
+// ArchiveName returns the file name of the module archive.
+func (m Module) ArchiveName() string {
+	return m.String() + ".tgz"
+}
+
+func (m Module) String() string {
+	return str(m.Name, m.Version)
+}
+
+func str(n, v string) string {
+	return n + "-" + v
+}
@@ -0,0 +1,84 @@
+// Package index reads and writes index files
+// with the HostOSConfigurationModules object.
+package index
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Mirantis/host-os-modules/cmd/pkg/domain"
+
+	"gopkg.in/yaml.v3"
+)
+
+// New returns the HostOSConfigurationModules object with the given modules,
+// apiVersion defaults to the kaas.mirantis.com/v1alpha1 if empty.
+func New(apiVersion, name string, modules []domain.Module) domain.HostOSConfigurationModules {
+	if apiVersion == "" {
+		apiVersion = domain.HOCMAPIVersion
+	}
+
+	var index domain.HostOSConfigurationModules
+	index.APIVersion = apiVersion
+	index.Kind = domain.HOCMKind
+	index.Metadata.Name = name
+	index.Spec.Modules = modules
+	return index
+}
+
+// Read deserializes the HostOSConfigurationModules object from the file.
+func Read(ctx context.Context, name string) (domain.HostOSConfigurationModules, error) {
+	var index domain.HostOSConfigurationModules
+	if err := ctx.Err(); err != nil {
+		return index, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return index, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(&index); err != nil {
+		return index, fmt.Errorf("failed to deserialize data from %s: %w", name, err)
+	}
+
+	return index, nil
+}
+
+// Encode serializes the HostOSConfigurationModules object to w.
+func Encode(ctx context.Context, w io.Writer, index domain.HostOSConfigurationModules) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&index); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// Write serializes the HostOSConfigurationModules object to the file,
+// overwriting its previous contents.
+func Write(ctx context.Context, name string, index domain.HostOSConfigurationModules) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	if err := Encode(ctx, f, index); err != nil {
+		return fmt.Errorf("failed to serialize data to the %s: %w", name, err)
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,86 @@
+// Package version implements semver bumps of host OS configuration modules.
+//
+// Every change of a module produces the next patch dev version, e.g.
+// 1.0.1 -> 1.0.2-dev and 1.0.2-dev -> 1.0.3-dev, and a dev version is
+// released by the minor or major promotion, e.g. 1.0.3-dev -> 1.1.0.
+package version
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// DevTag is the prerelease tag of module versions built from changes.
+const DevTag = "dev"
+
+// Promotion is the type of the release of a dev version.
+type Promotion int
+
+const (
+	PromoteNone Promotion = iota
+	PromoteMinor
+	PromoteMajor
+)
+
+// Set implements flag.Value.
+func (p *Promotion) Set(value string) error {
+	switch value {
+	case "none", "":
+		*p = PromoteNone
+	case "minor":
+		*p = PromoteMinor
+	case "major":
+		*p = PromoteMajor
+	default:
+		return fmt.Errorf("only one of [<empty>, none, minor, major], given %s", value)
+	}
+	return nil
+}
+
+func (p Promotion) String() string {
+	switch p {
+	case PromoteNone:
+		return "None"
+	case PromoteMinor:
+		return "Minor"
+	case PromoteMajor:
+		return "Major"
+	default:
+		return ""
+	}
+}
+
+// Bump returns the next version of the module. A changed module gets the
+// next patch dev version, while a dev version of an unchanged one is released
+// according to the promotion. The current version is returned as is
+// if neither applies, e.g. a released version is promoted again.
+func Bump(current string, changed bool, p Promotion) (string, error) {
+	v, err := semver.NewVersion(current)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse module version %s: %w", current, err)
+	}
+
+	if changed && p != PromoteNone {
+		return "", fmt.Errorf("version %s has changes and can not be promoted", current)
+	}
+
+	isPrerelease := v.Prerelease() != ""
+	switch {
+	case changed:
+		next := v.IncPatch()
+		if isPrerelease {
+			next = next.IncPatch() // incrementing on pre-version just drops it without increasing
+		}
+		if next, err = next.SetPrerelease(DevTag); err != nil {
+			return "", fmt.Errorf("failed to set prerelease version %s: %w", current, err)
+		}
+		return next.String(), nil
+	case p == PromoteMajor && isPrerelease:
+		return v.IncMajor().String(), nil
+	case p == PromoteMinor && isPrerelease:
+		return v.IncMinor().String(), nil
+	default:
+		return current, nil
+	}
+}
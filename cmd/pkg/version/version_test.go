@@ -0,0 +1,36 @@
+package version
+
+import "testing"
+
+func TestBump(t *testing.T) {
+	for _, tc := range []struct {
+		current string
+		changed bool
+		promote Promotion
+		want    string
+	}{
+		{"1.0.1", false, PromoteNone, "1.0.1"},
+		{"1.0.1", true, PromoteNone, "1.0.2-dev"},
+		{"1.0.2-dev", true, PromoteNone, "1.0.3-dev"},
+		{"0.0.0", true, PromoteNone, "0.0.1-dev"},
+		{"1.0.3-dev", false, PromoteMinor, "1.1.0"},
+		{"1.0.3-dev", false, PromoteMajor, "2.0.0"},
+		{"1.1.0", false, PromoteMinor, "1.1.0"},
+	} {
+		got, err := Bump(tc.current, tc.changed, tc.promote)
+		if err != nil {
+			t.Errorf("Bump(%s, %t, %s): %v", tc.current, tc.changed, tc.promote, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Bump(%s, %t, %s) = %s, want %s", tc.current, tc.changed, tc.promote, got, tc.want)
+		}
+	}
+
+	if _, err := Bump("1.0.2-dev", true, PromoteMinor); err == nil {
+		t.Error("changed version is promoted")
+	}
+	if _, err := Bump("not-a-version", false, PromoteNone); err == nil {
+		t.Error("malformed version is accepted")
+	}
+}